@@ -0,0 +1,137 @@
+package main
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+// histogram is a log-linear latency histogram in the spirit of HdrHistogram.
+// Values below 2^subBucketBits nanoseconds get their own bucket; above that
+// every power of two is split into 2^(subBucketBits-1) buckets, which keeps
+// the relative error under 1/64 (~1.6%) with a few thousand counters.
+//
+// A histogram is not safe for concurrent use; every benchmark client records
+// into its own and the results are merged at the end.
+type histogram struct {
+	counts []uint64
+	total  uint64
+	sum    float64
+	min    int64
+	max    int64
+}
+
+const (
+	subBucketBits  = 7
+	subBucketCount = 1 << subBucketBits
+	subBucketHalf  = subBucketCount / 2
+	// 40 bits of nanoseconds is a little over 18 minutes.
+	histogramBuckets = subBucketCount + (40-subBucketBits)*subBucketHalf
+)
+
+func newHistogram() *histogram {
+	return &histogram{
+		counts: make([]uint64, histogramBuckets),
+		min:    math.MaxInt64,
+	}
+}
+
+func bucketIndex(v int64) int {
+	if v < subBucketCount {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - subBucketBits
+	mantissa := int(v >> shift) // in [subBucketHalf, subBucketCount)
+	idx := subBucketCount + (shift-1)*subBucketHalf + mantissa - subBucketHalf
+	if idx >= histogramBuckets {
+		idx = histogramBuckets - 1
+	}
+	return idx
+}
+
+// bucketUpperBound returns the largest value that lands in bucket idx.
+func bucketUpperBound(idx int) int64 {
+	if idx < subBucketCount {
+		return int64(idx)
+	}
+	shift := (idx-subBucketCount)/subBucketHalf + 1
+	mantissa := int64((idx-subBucketCount)%subBucketHalf + subBucketHalf)
+	return (mantissa+1)<<shift - 1
+}
+
+func (h *histogram) record(d time.Duration) {
+	v := int64(d)
+	if v < 0 {
+		v = 0
+	}
+	h.counts[bucketIndex(v)]++
+	h.total++
+	h.sum += float64(v)
+	if v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+}
+
+func (h *histogram) merge(other *histogram) {
+	for i, c := range other.counts {
+		h.counts[i] += c
+	}
+	h.total += other.total
+	h.sum += other.sum
+	if other.min < h.min {
+		h.min = other.min
+	}
+	if other.max > h.max {
+		h.max = other.max
+	}
+}
+
+// percentile returns the latency at or below which q (0..100) percent of
+// the recorded values fall.
+func (h *histogram) percentile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q / 100 * float64(h.total)))
+	if rank == 0 {
+		rank = 1
+	}
+	var seen uint64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			upper := bucketUpperBound(i)
+			if upper > h.max {
+				upper = h.max
+			}
+			return time.Duration(upper)
+		}
+	}
+	return time.Duration(h.max)
+}
+
+func (h *histogram) mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.sum / float64(h.total))
+}
+
+// buckets returns the non-empty buckets as (upper bound, count) pairs.
+func (h *histogram) buckets() []histogramBucket {
+	var out []histogramBucket
+	for i, c := range h.counts {
+		if c > 0 {
+			out = append(out, histogramBucket{UpperBoundNs: bucketUpperBound(i), Count: c})
+		}
+	}
+	return out
+}
+
+type histogramBucket struct {
+	UpperBoundNs int64  `json:"le_ns"`
+	Count        uint64 `json:"count"`
+}
@@ -0,0 +1,314 @@
+// cache_bench is a load generator for the cache server.
+//
+//	go run ./networking/cache_bench -clients 50 -duration 30s -read-ratio 0.9
+//	go run ./networking/cache_bench -requests 100000 -pipeline 16 -json report.json
+//
+// By default every client keeps one connection open and sends -pipeline
+// commands before reading the replies (closed loop). Latency is measured per
+// command from the moment its batch is flushed until its reply arrives, and
+// reported as percentiles.
+//
+// With -mode open the clients instead send at a fixed target rate, optionally
+// ramped up over the run, and measure latency from the intended send time:
+//
+//	go run ./networking/cache_bench -mode open -rate 5000 -duration 30s
+//	go run ./networking/cache_bench -mode open -rate 1000 -rate-end 50000 -ramp step -ramp-steps 10 -duration 100s
+//
+// Keys and value sizes follow -key-dist and -value-dist, or the commands of
+// a recorded -trace (for example captured with MONITOR) are replayed:
+//
+//	go run ./networking/cache_bench -keys 1000000 -key-dist zipfian:0.99 -value-dist uniform:16:4096
+//	go run ./networking/cache_bench -trace monitor.log
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-cookbook/networking/cache_client"
+)
+
+type config struct {
+	Mode      string        `json:"mode"`
+	Addr      string        `json:"addr"`
+	Clients   int           `json:"clients"`
+	Duration  time.Duration `json:"duration_ns"`
+	Requests  int64         `json:"requests"`
+	Keys      int           `json:"keys"`
+	KeyDist   string        `json:"key_dist"`
+	ValueSize int           `json:"value_size"`
+	ValueDist string        `json:"value_dist"`
+	Trace     string        `json:"trace,omitempty"`
+	ReadRatio float64       `json:"read_ratio"`
+	Pipeline  int           `json:"pipeline"`
+	Think     time.Duration `json:"think_ns"`
+	Seed      int64         `json:"seed"`
+
+	// Open-loop mode only.
+	Schedule *rateSchedule `json:"schedule,omitempty"`
+	Interval time.Duration `json:"interval_ns,omitempty"`
+}
+
+// clientStats is owned by a single client goroutine while the test runs.
+type clientStats struct {
+	latency map[string]*histogram // by command, plus "ALL"
+	// intervals holds the latencies of an open-loop run by timeline interval.
+	intervals map[int]*histogram
+	ops       uint64
+	misses    uint64
+	errors    map[string]uint64
+}
+
+func newClientStats() *clientStats {
+	return &clientStats{
+		latency:   map[string]*histogram{"ALL": newHistogram()},
+		intervals: make(map[int]*histogram),
+		errors:    make(map[string]uint64),
+	}
+}
+
+func (s *clientStats) record(command string, d time.Duration) {
+	h, ok := s.latency[command]
+	if !ok {
+		h = newHistogram()
+		s.latency[command] = h
+	}
+	h.record(d)
+	s.latency["ALL"].record(d)
+	s.ops++
+}
+
+func (s *clientStats) recordInterval(idx int, d time.Duration) {
+	h, ok := s.intervals[idx]
+	if !ok {
+		h = newHistogram()
+		s.intervals[idx] = h
+	}
+	h.record(d)
+}
+
+func main() {
+	var cfg config
+	var jsonPath string
+	var schedule rateSchedule
+	flag.StringVar(&cfg.Mode, "mode", "closed", "load model: closed (wait for replies) or open (fixed arrival rate)")
+	flag.StringVar(&cfg.Addr, "addr", "localhost:7070", "cache server address")
+	flag.IntVar(&cfg.Clients, "clients", 10, "number of concurrent connections")
+	flag.DurationVar(&cfg.Duration, "duration", 10*time.Second, "how long to run (ignored when -requests is set)")
+	flag.Int64Var(&cfg.Requests, "requests", 0, "total number of commands to send across all clients")
+	flag.IntVar(&cfg.Keys, "keys", 10000, "size of the key space")
+	flag.StringVar(&cfg.KeyDist, "key-dist", "uniform", "key distribution: uniform, zipfian[:theta], latest[:theta] or hotspot[:keys:ops]")
+	flag.IntVar(&cfg.ValueSize, "value-size", 32, "size of SET values in bytes")
+	flag.StringVar(&cfg.ValueDist, "value-dist", "fixed", "value size distribution: fixed[:size], uniform:min:max or normal[:mean:stddev]")
+	flag.StringVar(&cfg.Trace, "trace", "", "replay the commands in `file` instead of generating them")
+	flag.Float64Var(&cfg.ReadRatio, "read-ratio", 0.5, "fraction of commands that are GETs")
+	flag.IntVar(&cfg.Pipeline, "pipeline", 1, "commands sent per round trip")
+	flag.DurationVar(&cfg.Think, "think", 0, "pause between round trips")
+	flag.Int64Var(&cfg.Seed, "seed", time.Now().UnixNano(), "random seed")
+	flag.Float64Var(&schedule.Start, "rate", 1000, "open loop: target requests per second across all clients")
+	flag.Float64Var(&schedule.End, "rate-end", 0, "open loop: final target rate when ramping")
+	flag.StringVar(&schedule.Ramp, "ramp", "none", "open loop: rate schedule, one of none, step or linear")
+	flag.IntVar(&schedule.Steps, "ramp-steps", 5, "open loop: number of steps with -ramp step")
+	flag.DurationVar(&cfg.Interval, "interval", time.Second, "open loop: timeline resolution")
+	flag.StringVar(&jsonPath, "json", "", "write a JSON report to `file` (\"-\" for stdout, moving the text report to stderr)")
+	flag.Parse()
+
+	if cfg.Clients < 1 || cfg.Pipeline < 1 || cfg.Keys < 1 || cfg.ValueSize < 0 {
+		log.Fatal("-clients, -pipeline and -keys must be positive")
+	}
+	if cfg.ReadRatio < 0 || cfg.ReadRatio > 1 {
+		log.Fatal("-read-ratio must be between 0 and 1")
+	}
+
+	wl, err := newWorkload(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var r *report
+	switch cfg.Mode {
+	case "closed":
+		r = run(cfg, wl)
+	case "open":
+		schedule.Duration = cfg.Duration
+		if err := schedule.validate(); err != nil {
+			log.Fatal(err)
+		}
+		if cfg.Interval <= 0 {
+			log.Fatal("-interval must be positive")
+		}
+		cfg.Schedule = &schedule
+		r = runOpenLoop(cfg, wl)
+	default:
+		log.Fatalf("unknown -mode %q (want closed or open)", cfg.Mode)
+	}
+	// With -json - stdout carries only the JSON, so it can be piped to
+	// another tool; the human-readable report goes to stderr instead.
+	human := os.Stdout
+	if jsonPath == "-" {
+		human = os.Stderr
+	}
+	r.print(human)
+	if jsonPath != "" {
+		if err := r.writeJSON(jsonPath); err != nil {
+			log.Fatal("Failed to write JSON report:", err)
+		}
+	}
+}
+
+func run(cfg config, wl workload) *report {
+	var wg sync.WaitGroup
+	stats := make([]*clientStats, cfg.Clients)
+
+	// budget is the number of commands left to send when -requests is set.
+	budget := cfg.Requests
+	deadline := time.Now().Add(cfg.Duration)
+	if cfg.Requests > 0 {
+		deadline = time.Time{}
+	}
+
+	testStart := time.Now()
+	for i := 0; i < cfg.Clients; i++ {
+		stats[i] = newClientStats()
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(cfg.Seed + int64(i)))
+			clientOperation(cfg, rng, wl, &budget, deadline, stats[i])
+		}(i)
+	}
+	wg.Wait()
+	testDuration := time.Since(testStart)
+
+	return buildReport(cfg, testStart, testDuration, stats)
+}
+
+// claim reserves up to n commands from the shared budget. Duration-based
+// runs are not limited and always get n.
+func claim(budget *int64, limited bool, n int) int {
+	if !limited {
+		return n
+	}
+	for {
+		left := atomic.LoadInt64(budget)
+		if left <= 0 {
+			return 0
+		}
+		take := int64(n)
+		if take > left {
+			take = left
+		}
+		if atomic.CompareAndSwapInt64(budget, left, left-take) {
+			return int(take)
+		}
+	}
+}
+
+// clientOperation drives one connection in a closed loop: send a batch,
+// wait for every reply, think, repeat.
+func clientOperation(cfg config, rng *rand.Rand, wl workload, budget *int64, deadline time.Time, stats *clientStats) {
+	conn, err := net.Dial("tcp", cfg.Addr)
+	if err != nil {
+		stats.errors["connect"]++
+		return
+	}
+	defer conn.Close()
+	writer := bufio.NewWriter(conn)
+	reader := bufio.NewReader(conn)
+
+	var reqID uint64
+	batch := make([]op, 0, cfg.Pipeline)
+	for deadline.IsZero() || time.Now().Before(deadline) {
+		n := claim(budget, deadline.IsZero(), cfg.Pipeline)
+		if n == 0 {
+			return
+		}
+
+		batch = batch[:0]
+		for i := 0; i < n; i++ {
+			o := wl.next(rng)
+			batch = append(batch, o)
+			reqID++
+			writeOp(writer, reqID, o)
+		}
+
+		start := time.Now()
+		if err := writer.Flush(); err != nil {
+			stats.errors["write"]++
+			return
+		}
+		for _, o := range batch {
+			response, err := reader.ReadString('\n')
+			if err != nil {
+				stats.errors["read"]++
+				return
+			}
+			stats.record(o.command, time.Since(start))
+			classify(stats, response)
+		}
+
+		if cfg.Think > 0 {
+			time.Sleep(cfg.Think)
+		}
+	}
+}
+
+func writeOp(w *bufio.Writer, reqID uint64, o op) {
+	if o.value != "" {
+		fmt.Fprintf(w, "%d %s %s %s\n", reqID, o.command, o.key, o.value)
+		return
+	}
+	fmt.Fprintf(w, "%d %s %s\n", reqID, o.command, o.key)
+}
+
+// classify counts a reply as a hit, a miss or a server error.
+func classify(stats *clientStats, response string) {
+	reply, err := cache_client.ParseReply(response)
+	switch {
+	case err != nil:
+		stats.errors["protocol"]++
+	case reply.OK:
+	case reply.Value == "NOT FOUND":
+		stats.misses++
+	default:
+		stats.errors["server: "+reply.Value]++
+	}
+}
+
+func buildReport(cfg config, start time.Time, duration time.Duration, stats []*clientStats) *report {
+	r := &report{
+		Config:      cfg,
+		Start:       start,
+		DurationSec: duration.Seconds(),
+		Errors:      make(map[string]uint64),
+		Latency:     make(map[string]latencySummary),
+	}
+
+	merged := make(map[string]*histogram)
+	for _, s := range stats {
+		r.Ops += s.ops
+		r.Misses += s.misses
+		for kind, n := range s.errors {
+			r.Errors[kind] += n
+		}
+		for name, h := range s.latency {
+			if merged[name] == nil {
+				merged[name] = newHistogram()
+			}
+			merged[name].merge(h)
+		}
+	}
+	for name, h := range merged {
+		r.Latency[name] = summarize(h)
+	}
+	r.OpsPerSec = float64(r.Ops) / duration.Seconds()
+	return r
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// Open-loop mode sends requests at the rate given by the schedule no matter
+// how quickly the server answers, and measures each request's latency from
+// the time it was *supposed* to be sent. A closed-loop client that waits for
+// every reply quietly sends less while the server stalls, so the stall only
+// shows up as a handful of slow requests ("coordinated omission"); here it
+// shows up in every request that should have been sent during the stall.
+
+// drainTimeout bounds how long we wait for outstanding replies after the
+// last request has been sent.
+const drainTimeout = 5 * time.Second
+
+// inflight is a request that has been written but not yet answered.
+type inflight struct {
+	intended time.Time
+	command  string
+}
+
+func runOpenLoop(cfg config, wl workload) *report {
+	// Receivers are only told to give up once every request has actually
+	// been sent, not merely handed to a sender.
+	var senders, receivers sync.WaitGroup
+	stats := make([]*clientStats, cfg.Clients)
+	sendErrors := make([]map[string]uint64, cfg.Clients)
+	tickets := make([]chan time.Time, cfg.Clients)
+	conns := make([]net.Conn, cfg.Clients)
+
+	for i := 0; i < cfg.Clients; i++ {
+		stats[i] = newClientStats()
+		sendErrors[i] = make(map[string]uint64)
+		tickets[i] = make(chan time.Time, 1024)
+
+		conn, err := net.Dial("tcp", cfg.Addr)
+		if err != nil {
+			stats[i].errors["connect"]++
+		}
+		conns[i] = conn
+	}
+
+	testStart := time.Now()
+	for i := 0; i < cfg.Clients; i++ {
+		pending := make(chan inflight, 65536)
+		senders.Add(1)
+		receivers.Add(1)
+		go func(i int) {
+			defer senders.Done()
+			defer close(pending)
+			rng := rand.New(rand.NewSource(cfg.Seed + int64(i)))
+			openLoopSender(conns[i], rng, wl, tickets[i], pending, sendErrors[i])
+		}(i)
+		go func(i int) {
+			defer receivers.Done()
+			openLoopReceiver(conns[i], pending, testStart, cfg.Interval, stats[i])
+		}(i)
+	}
+
+	// Hand out the intended send times round-robin across the connections.
+	var sent int64
+	cfg.Schedule.sendTimes(testStart, func(intended time.Time) bool {
+		if cfg.Requests > 0 && sent >= cfg.Requests {
+			return false
+		}
+		tickets[sent%int64(cfg.Clients)] <- intended
+		sent++
+		return true
+	})
+	for i := range tickets {
+		close(tickets[i])
+	}
+
+	senders.Wait()
+	deadline := time.Now().Add(drainTimeout)
+	for _, conn := range conns {
+		if conn != nil {
+			conn.SetReadDeadline(deadline)
+		}
+	}
+	receivers.Wait()
+	testDuration := time.Since(testStart)
+
+	for i, conn := range conns {
+		if conn != nil {
+			conn.Close()
+		}
+		for kind, n := range sendErrors[i] {
+			stats[i].errors[kind] += n
+		}
+	}
+
+	r := buildReport(cfg, testStart, testDuration, stats)
+	r.Timeline = buildTimeline(cfg, stats)
+	return r
+}
+
+// openLoopSender writes one request per ticket, sleeping until the ticket's
+// intended time. If it falls behind it sends immediately; the lateness is
+// charged to the request's latency by the receiver.
+func openLoopSender(conn net.Conn, rng *rand.Rand, wl workload, tickets <-chan time.Time, pending chan<- inflight, errors map[string]uint64) {
+	if conn == nil {
+		for range tickets {
+			errors["dropped"]++
+		}
+		return
+	}
+	writer := bufio.NewWriter(conn)
+
+	var reqID uint64
+	failed := false
+	for intended := range tickets {
+		if failed {
+			errors["dropped"]++
+			continue
+		}
+		if wait := time.Until(intended); wait > 0 {
+			time.Sleep(wait)
+		}
+
+		o := wl.next(rng)
+		reqID++
+		writeOp(writer, reqID, o)
+		// Register the request before it can possibly be answered.
+		pending <- inflight{intended: intended, command: o.command}
+		if err := writer.Flush(); err != nil {
+			errors["write"]++
+			failed = true
+		}
+	}
+}
+
+// openLoopReceiver matches replies to requests in order; the server answers
+// the commands of one connection in the order it received them.
+func openLoopReceiver(conn net.Conn, pending <-chan inflight, start time.Time, interval time.Duration, stats *clientStats) {
+	var reader *bufio.Reader
+	if conn != nil {
+		reader = bufio.NewReader(conn)
+	}
+
+	failed := false
+	for p := range pending {
+		if failed {
+			stats.errors["unanswered"]++
+			continue
+		}
+		response, err := reader.ReadString('\n')
+		if err != nil {
+			stats.errors["read"]++
+			failed = true
+			continue
+		}
+		latency := time.Since(p.intended)
+		stats.record(p.command, latency)
+		stats.recordInterval(int(p.intended.Sub(start)/interval), latency)
+		classify(stats, response)
+	}
+}
+
+// intervalSummary is one row of the open-loop timeline.
+type intervalSummary struct {
+	OffsetSec  float64 `json:"offset_sec"`
+	TargetRate float64 `json:"target_rate"`
+	Completed  uint64  `json:"completed"`
+	P50Ns      int64   `json:"p50_ns"`
+	P99Ns      int64   `json:"p99_ns"`
+	MaxNs      int64   `json:"max_ns"`
+}
+
+func buildTimeline(cfg config, stats []*clientStats) []intervalSummary {
+	var timeline []intervalSummary
+	for idx := 0; ; idx++ {
+		offset := time.Duration(idx) * cfg.Interval
+		if offset >= cfg.Schedule.Duration {
+			return timeline
+		}
+
+		h := newHistogram()
+		for _, s := range stats {
+			if ih := s.intervals[idx]; ih != nil {
+				h.merge(ih)
+			}
+		}
+		timeline = append(timeline, intervalSummary{
+			OffsetSec:  offset.Seconds(),
+			TargetRate: cfg.Schedule.rateAt(offset + cfg.Interval/2),
+			Completed:  h.total,
+			P50Ns:      int64(h.percentile(50)),
+			P99Ns:      int64(h.percentile(99)),
+			MaxNs:      h.max,
+		})
+	}
+}
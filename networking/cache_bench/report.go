@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// report is the result of a benchmark run. It is printed for humans and
+// optionally written as JSON so runs can be compared over time.
+type report struct {
+	Config      config                    `json:"config"`
+	Start       time.Time                 `json:"start"`
+	DurationSec float64                   `json:"duration_sec"`
+	Ops         uint64                    `json:"ops"`
+	OpsPerSec   float64                   `json:"ops_per_sec"`
+	Misses      uint64                    `json:"misses"`
+	Errors      map[string]uint64         `json:"errors"`
+	Latency     map[string]latencySummary `json:"latency"`
+	Timeline    []intervalSummary         `json:"timeline,omitempty"`
+}
+
+type latencySummary struct {
+	Count   uint64            `json:"count"`
+	MinNs   int64             `json:"min_ns"`
+	MeanNs  int64             `json:"mean_ns"`
+	P50Ns   int64             `json:"p50_ns"`
+	P90Ns   int64             `json:"p90_ns"`
+	P99Ns   int64             `json:"p99_ns"`
+	P999Ns  int64             `json:"p999_ns"`
+	MaxNs   int64             `json:"max_ns"`
+	Buckets []histogramBucket `json:"buckets"`
+}
+
+func summarize(h *histogram) latencySummary {
+	s := latencySummary{
+		Count:   h.total,
+		MeanNs:  int64(h.mean()),
+		P50Ns:   int64(h.percentile(50)),
+		P90Ns:   int64(h.percentile(90)),
+		P99Ns:   int64(h.percentile(99)),
+		P999Ns:  int64(h.percentile(99.9)),
+		MaxNs:   h.max,
+		Buckets: h.buckets(),
+	}
+	if h.total > 0 {
+		s.MinNs = h.min
+	}
+	return s
+}
+
+func (r *report) print(w io.Writer) {
+	fmt.Fprintf(w, "Load test completed in %v.\n", time.Duration(r.DurationSec*float64(time.Second)).Round(time.Millisecond))
+	fmt.Fprintf(w, "Total operations: %d (%d misses)\n", r.Ops, r.Misses)
+	fmt.Fprintf(w, "Requests per second (RPS): %.2f\n", r.OpsPerSec)
+
+	if len(r.Errors) > 0 {
+		fmt.Fprintln(w, "Errors:")
+		kinds := make([]string, 0, len(r.Errors))
+		for kind := range r.Errors {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		for _, kind := range kinds {
+			fmt.Fprintf(w, "  %-30s %d\n", kind, r.Errors[kind])
+		}
+	}
+
+	fmt.Fprintf(w, "\n%-6s %10s %10s %10s %10s %10s %10s %10s %10s\n",
+		"", "count", "min", "mean", "p50", "p90", "p99", "p99.9", "max")
+	names := make([]string, 0, len(r.Latency))
+	for name := range r.Latency {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s := r.Latency[name]
+		fmt.Fprintf(w, "%-6s %10d %10v %10v %10v %10v %10v %10v %10v\n",
+			name, s.Count,
+			roundLatency(s.MinNs), roundLatency(s.MeanNs), roundLatency(s.P50Ns),
+			roundLatency(s.P90Ns), roundLatency(s.P99Ns), roundLatency(s.P999Ns),
+			roundLatency(s.MaxNs))
+	}
+
+	if len(r.Timeline) > 0 {
+		fmt.Fprintf(w, "\n%8s %10s %10s %10s %10s %10s\n",
+			"offset", "target/s", "done/s", "p50", "p99", "max")
+		for _, t := range r.Timeline {
+			fmt.Fprintf(w, "%7.1fs %10.0f %10.0f %10v %10v %10v\n",
+				t.OffsetSec, t.TargetRate,
+				float64(t.Completed)/r.Config.Interval.Seconds(),
+				roundLatency(t.P50Ns), roundLatency(t.P99Ns), roundLatency(t.MaxNs))
+		}
+	}
+}
+
+func roundLatency(ns int64) time.Duration {
+	return time.Duration(ns).Round(time.Microsecond)
+}
+
+// writeJSON writes the report to path, or to stdout when path is "-".
+func (r *report) writeJSON(path string) error {
+	var w io.Writer = os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// rateSchedule describes the target request rate of an open-loop run over
+// time. With ramp "none" the rate stays at start for the whole run; "step"
+// raises it from start to end in a number of equal steps, and "linear"
+// interpolates continuously. Stepping or ramping past the server's capacity
+// shows up in the timeline as latency that grows without bound.
+type rateSchedule struct {
+	Ramp     string        `json:"ramp"`
+	Start    float64       `json:"start_rate"`
+	End      float64       `json:"end_rate"`
+	Steps    int           `json:"steps"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+func (s rateSchedule) validate() error {
+	if s.Start <= 0 {
+		return fmt.Errorf("-rate must be positive in open-loop mode")
+	}
+	switch s.Ramp {
+	case "none":
+	case "step":
+		if s.Steps < 1 {
+			return fmt.Errorf("-ramp-steps must be at least 1")
+		}
+		fallthrough
+	case "linear":
+		if s.End <= 0 {
+			return fmt.Errorf("-rate-end must be positive with -ramp %s", s.Ramp)
+		}
+	default:
+		return fmt.Errorf("unknown -ramp %q (want none, step or linear)", s.Ramp)
+	}
+	return nil
+}
+
+// rateAt returns the target rate in requests per second at elapsed.
+func (s rateSchedule) rateAt(elapsed time.Duration) float64 {
+	progress := math.Min(float64(elapsed)/float64(s.Duration), 1)
+	switch s.Ramp {
+	case "step":
+		step := math.Min(math.Floor(progress*float64(s.Steps)), float64(s.Steps-1))
+		if s.Steps == 1 {
+			return s.Start
+		}
+		return s.Start + (s.End-s.Start)*step/float64(s.Steps-1)
+	case "linear":
+		return s.Start + (s.End-s.Start)*progress
+	default:
+		return s.Start
+	}
+}
+
+// sendTimes calls fn with the intended send time of every request, in
+// order, until the schedule ends or fn returns false. The times are derived
+// from the schedule alone, never from how fast the server answers.
+func (s rateSchedule) sendTimes(start time.Time, fn func(intended time.Time) bool) {
+	var elapsed time.Duration
+	for elapsed < s.Duration {
+		if !fn(start.Add(elapsed)) {
+			return
+		}
+		elapsed += time.Duration(float64(time.Second) / s.rateAt(elapsed))
+	}
+}
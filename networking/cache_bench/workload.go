@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// op is a single command the benchmark sends to the server.
+type op struct {
+	command string // "GET", "SET" or "DEL"
+	key     string
+	value   string
+}
+
+// workload produces the stream of operations. One workload is shared by all
+// clients, so implementations may only use the client's random source and
+// atomics for mutable state.
+type workload interface {
+	next(rng *rand.Rand) op
+}
+
+// newWorkload builds the workload from the -key-dist, -value-dist and
+// -trace flags.
+func newWorkload(cfg config) (workload, error) {
+	if cfg.Trace != "" {
+		return loadTrace(cfg.Trace)
+	}
+
+	keys, err := parseKeyDist(cfg.KeyDist, cfg.Keys)
+	if err != nil {
+		return nil, err
+	}
+	sizes, err := parseValueDist(cfg.ValueDist, cfg.ValueSize)
+	if err != nil {
+		return nil, err
+	}
+	values := randomValue(rand.New(rand.NewSource(cfg.Seed)), 2*sizes.max()+1)
+
+	return &profileWorkload{keys: keys, sizes: sizes, values: values, readRatio: cfg.ReadRatio}, nil
+}
+
+// profileWorkload issues GETs with probability readRatio and SETs otherwise,
+// drawing keys and value sizes from the configured distributions.
+type profileWorkload struct {
+	keys      keyChooser
+	sizes     valueSizer
+	values    string
+	readRatio float64
+}
+
+func (w *profileWorkload) next(rng *rand.Rand) op {
+	if rng.Float64() < w.readRatio {
+		return op{command: "GET", key: keyName(w.keys.next(rng))}
+	}
+
+	idx := 0
+	if wk, ok := w.keys.(writeKeyChooser); ok {
+		idx = wk.nextWrite()
+	} else {
+		idx = w.keys.next(rng)
+	}
+	size := w.sizes.next(rng)
+	start := rng.Intn(len(w.values) - size)
+	return op{command: "SET", key: keyName(idx), value: w.values[start : start+size]}
+}
+
+func keyName(idx int) string {
+	return "key:" + strconv.Itoa(idx)
+}
+
+// keyChooser picks the index of the key for the next operation.
+type keyChooser interface {
+	next(rng *rand.Rand) int
+}
+
+// writeKeyChooser is implemented by distributions where writes choose their
+// key differently from reads.
+type writeKeyChooser interface {
+	nextWrite() int
+}
+
+// parseKeyDist parses a key distribution spec:
+//
+//	uniform                 every key equally likely
+//	zipfian[:theta]         a few keys are very hot; theta in (0,1), default 0.99
+//	latest[:theta]          writes create new keys, reads favour the newest ones
+//	hotspot[:keys:ops]      a fraction of the keys gets a fraction of the
+//	                        operations, default hotspot:0.2:0.8
+func parseKeyDist(spec string, n int) (keyChooser, error) {
+	name, args, err := parseSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	switch name {
+	case "uniform":
+		return uniformKeys(n), nil
+	case "zipfian", "latest":
+		theta := 0.99
+		if len(args) > 0 {
+			theta = args[0]
+		}
+		if theta <= 0 || theta >= 1 {
+			return nil, fmt.Errorf("-key-dist %s: theta must be between 0 and 1", name)
+		}
+		z := newZipfian(n, theta)
+		if name == "latest" {
+			return &latestKeys{zipf: z, inserted: int64(n)}, nil
+		}
+		return &scrambledKeys{zipf: z}, nil
+	case "hotspot":
+		h := &hotspotKeys{n: n, hotKeys: 0.2, hotOps: 0.8}
+		if len(args) > 0 {
+			h.hotKeys = args[0]
+		}
+		if len(args) > 1 {
+			h.hotOps = args[1]
+		}
+		if h.hotKeys <= 0 || h.hotKeys > 1 || h.hotOps < 0 || h.hotOps > 1 {
+			return nil, fmt.Errorf("-key-dist hotspot: fractions must be between 0 and 1")
+		}
+		return h, nil
+	default:
+		return nil, fmt.Errorf("unknown -key-dist %q (want uniform, zipfian, latest or hotspot)", name)
+	}
+}
+
+type uniformKeys int
+
+func (n uniformKeys) next(rng *rand.Rand) int {
+	return rng.Intn(int(n))
+}
+
+// zipfian draws ranks in [0, n) where rank 0 is the most popular, using the
+// algorithm from Gray et al., "Quickly Generating Billion-Record Synthetic
+// Databases" (as in YCSB). Unlike math/rand.Zipf it accepts skews below 1.
+type zipfian struct {
+	n     float64
+	theta float64
+	alpha float64
+	zetan float64
+	eta   float64
+}
+
+func newZipfian(n int, theta float64) *zipfian {
+	zeta := func(n int) float64 {
+		sum := 0.0
+		for i := 1; i <= n; i++ {
+			sum += 1 / math.Pow(float64(i), theta)
+		}
+		return sum
+	}
+	zetan := zeta(n)
+	return &zipfian{
+		n:     float64(n),
+		theta: theta,
+		alpha: 1 / (1 - theta),
+		zetan: zetan,
+		eta:   (1 - math.Pow(2/float64(n), 1-theta)) / (1 - zeta(2)/zetan),
+	}
+}
+
+func (z *zipfian) next(rng *rand.Rand) int {
+	u := rng.Float64()
+	uz := u * z.zetan
+	if uz < 1 {
+		return 0
+	}
+	if uz < 1+math.Pow(0.5, z.theta) {
+		return 1
+	}
+	rank := int(z.n * math.Pow(z.eta*u-z.eta+1, z.alpha))
+	if rank >= int(z.n) {
+		rank = int(z.n) - 1
+	}
+	return rank
+}
+
+// scrambledKeys hashes Zipfian ranks so the hot keys are spread over the key
+// space instead of being key:0, key:1, ..., which matters when testing
+// sharding.
+type scrambledKeys struct {
+	zipf *zipfian
+}
+
+func (s *scrambledKeys) next(rng *rand.Rand) int {
+	h := fnv.New64a()
+	fmt.Fprint(h, s.zipf.next(rng))
+	return int(h.Sum64() % uint64(s.zipf.n))
+}
+
+// latestKeys assumes the key space is preloaded; every write creates the
+// next new key and reads are Zipfian-distributed by age, newest first.
+type latestKeys struct {
+	zipf     *zipfian
+	inserted int64
+}
+
+func (l *latestKeys) next(rng *rand.Rand) int {
+	newest := int(atomic.LoadInt64(&l.inserted)) - 1
+	idx := newest - l.zipf.next(rng)
+	if idx < 0 {
+		idx = 0
+	}
+	return idx
+}
+
+func (l *latestKeys) nextWrite() int {
+	return int(atomic.AddInt64(&l.inserted, 1)) - 1
+}
+
+// hotspotKeys sends hotOps of the operations to the first hotKeys of the
+// key space and spreads the rest uniformly over the remaining keys.
+type hotspotKeys struct {
+	n       int
+	hotKeys float64
+	hotOps  float64
+}
+
+func (h *hotspotKeys) next(rng *rand.Rand) int {
+	hot := int(float64(h.n) * h.hotKeys)
+	if hot < 1 {
+		hot = 1
+	}
+	if rng.Float64() < h.hotOps || hot == h.n {
+		return rng.Intn(hot)
+	}
+	return hot + rng.Intn(h.n-hot)
+}
+
+// valueSizer picks the size of the next SET value.
+type valueSizer interface {
+	next(rng *rand.Rand) int
+	max() int
+}
+
+// parseValueDist parses a value size distribution spec. size is the
+// -value-size flag and is the default for the single-size distributions:
+//
+//	fixed[:size]            every value has the same size
+//	uniform:min:max         sizes uniformly distributed in [min, max]
+//	normal[:mean:stddev]    normally distributed, clamped to [0, mean+4*stddev]
+func parseValueDist(spec string, size int) (valueSizer, error) {
+	name, args, err := parseSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	switch name {
+	case "fixed":
+		if len(args) > 0 {
+			size = int(args[0])
+		}
+		if size < 0 {
+			return nil, fmt.Errorf("-value-dist fixed needs a non-negative size")
+		}
+		return fixedSize(size), nil
+	case "uniform":
+		if len(args) != 2 || args[0] < 0 || args[1] < args[0] {
+			return nil, fmt.Errorf("-value-dist uniform needs 0 <= min <= max")
+		}
+		return uniformSize{lo: int(args[0]), hi: int(args[1])}, nil
+	case "normal":
+		n := normalSize{mean: float64(size), stddev: float64(size) / 4}
+		if len(args) > 0 {
+			n.mean = args[0]
+		}
+		if len(args) > 1 {
+			n.stddev = args[1]
+		}
+		if n.mean < 0 || n.stddev < 0 {
+			return nil, fmt.Errorf("-value-dist normal needs a non-negative mean and stddev")
+		}
+		return n, nil
+	default:
+		return nil, fmt.Errorf("unknown -value-dist %q (want fixed, uniform or normal)", name)
+	}
+}
+
+type fixedSize int
+
+func (f fixedSize) next(*rand.Rand) int { return int(f) }
+func (f fixedSize) max() int            { return int(f) }
+
+type uniformSize struct {
+	lo, hi int
+}
+
+func (u uniformSize) next(rng *rand.Rand) int { return u.lo + rng.Intn(u.hi-u.lo+1) }
+func (u uniformSize) max() int                { return u.hi }
+
+type normalSize struct {
+	mean, stddev float64
+}
+
+func (n normalSize) next(rng *rand.Rand) int {
+	size := int(math.Round(rng.NormFloat64()*n.stddev + n.mean))
+	if size < 0 {
+		return 0
+	}
+	if size > n.max() {
+		return n.max()
+	}
+	return size
+}
+
+func (n normalSize) max() int { return int(n.mean + 4*n.stddev) }
+
+// parseSpec splits "name:1:2" into its name and numeric arguments.
+func parseSpec(spec string) (string, []float64, error) {
+	parts := strings.Split(spec, ":")
+	args := make([]float64, 0, len(parts)-1)
+	for _, p := range parts[1:] {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid argument %q in %q", p, spec)
+		}
+		args = append(args, v)
+	}
+	return parts[0], args, nil
+}
+
+const valueAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// randomValue returns a printable value of n bytes. Values may not contain
+// newlines, since the protocol is line based.
+func randomValue(rng *rand.Rand, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = valueAlphabet[rng.Intn(len(valueAlphabet))]
+	}
+	return string(b)
+}
+
+// traceWorkload replays recorded commands in order, shared by all clients,
+// starting over when the end of the trace is reached.
+type traceWorkload struct {
+	ops    []op
+	cursor uint64
+}
+
+func (t *traceWorkload) next(*rand.Rand) op {
+	i := atomic.AddUint64(&t.cursor, 1) - 1
+	return t.ops[i%uint64(len(t.ops))]
+}
+
+// loadTrace reads a command trace. Each line holds one command in any of
+// these forms, so the server's MONITOR output, a raw protocol capture or a
+// hand-written log can be replayed directly:
+//
+//	1700000000.123456 [3 127.0.0.1:51234] SET key value   (MONITOR)
+//	42 SET key value                                      (protocol)
+//	SET key value
+//
+// Commands other than GET, SET and DEL are skipped.
+func loadTrace(path string) (*traceWorkload, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	trace := &traceWorkload{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if o, ok := parseTraceLine(scanner.Text()); ok {
+			trace.ops = append(trace.ops, o)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(trace.ops) == 0 {
+		return nil, fmt.Errorf("trace %s contains no GET, SET or DEL commands", path)
+	}
+	return trace, nil
+}
+
+func parseTraceLine(line string) (op, bool) {
+	line = strings.TrimSpace(line)
+
+	// MONITOR prefix: a timestamp followed by "[client-id addr]".
+	if ts, rest, ok := strings.Cut(line, " "); ok && strings.HasPrefix(rest, "[") {
+		if _, err := strconv.ParseFloat(ts, 64); err == nil {
+			if _, after, ok := strings.Cut(rest, "] "); ok {
+				line = after
+			}
+		}
+	}
+	// Protocol prefix: a numeric request id.
+	if id, rest, ok := strings.Cut(line, " "); ok {
+		if _, err := strconv.ParseUint(id, 10, 64); err == nil {
+			line = rest
+		}
+	}
+
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) < 2 {
+		return op{}, false
+	}
+	o := op{command: strings.ToUpper(parts[0]), key: parts[1]}
+	switch o.command {
+	case "SET":
+		if len(parts) == 3 {
+			o.value = parts[2]
+		}
+	case "GET", "DEL":
+	default:
+		return op{}, false
+	}
+	return o, true
+}
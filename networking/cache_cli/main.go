@@ -0,0 +1,262 @@
+// cache-cli is an interactive client for the cache server.
+//
+//	go run ./networking/cache_cli                      # REPL
+//	go run ./networking/cache_cli GET foo              # one-shot
+//	go run ./networking/cache_cli -f commands.txt      # script from a file
+//	echo "GET foo" | go run ./networking/cache_cli     # script from stdin
+//	go run ./networking/cache_cli MONITOR > trace.log  # stream every command
+//
+// The REPL supports line editing, history (up/down arrows) and tab
+// completion of command names.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"go-cookbook/networking/cache_client"
+
+	"golang.org/x/term"
+)
+
+// commands lists the server commands and their subcommands for completion.
+var commands = map[string][]string{
+	"SET":     nil,
+	"GET":     nil,
+	"DEL":     nil,
+	"MONITOR": nil,
+	"CLIENT":  {"LIST", "SETNAME", "GETNAME", "KILL", "PAUSE"},
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:7070", "cache server address")
+	file := flag.String("f", "", "read commands from `file` (\"-\" for stdin)")
+	flag.Parse()
+
+	client, err := cache_client.NewCacheClient(*addr)
+	if err != nil {
+		log.Fatal("Failed to connect to cache server:", err)
+	}
+	defer client.Close()
+
+	switch {
+	case flag.NArg() == 1 && strings.EqualFold(flag.Arg(0), "MONITOR"):
+		err := client.Monitor(func(line string) bool {
+			fmt.Print(line)
+			return true
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	case flag.NArg() > 0:
+		ok, err := execute(client, os.Stdout, strings.Join(flag.Args(), " "))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+	case *file == "-":
+		runScript(client, os.Stdin)
+	case *file != "":
+		f, err := os.Open(*file)
+		if err != nil {
+			log.Fatal("Failed to open script:", err)
+		}
+		defer f.Close()
+		runScript(client, f)
+	case !term.IsTerminal(int(os.Stdin.Fd())):
+		runScript(client, os.Stdin)
+	default:
+		if err := repl(client, *addr); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// runScript executes one command per line, skipping blank lines and
+// lines starting with '#'.
+func runScript(client *cache_client.CacheClient, r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := execute(client, os.Stdout, line); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal("Failed to read script:", err)
+	}
+}
+
+func repl(client *cache_client.CacheClient, addr string) error {
+	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return err
+	}
+	defer term.Restore(int(os.Stdin.Fd()), oldState)
+
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, addr+"> ")
+	t.AutoCompleteCallback = complete
+
+	for {
+		line, err := t.ReadLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		line = strings.TrimSpace(line)
+		switch strings.ToUpper(line) {
+		case "":
+			continue
+		case "QUIT", "EXIT":
+			return nil
+		case "HELP":
+			fmt.Fprintln(t, "Commands: SET key value, GET key, DEL key,")
+			fmt.Fprintln(t, "          CLIENT LIST|SETNAME name|GETNAME|KILL id|PAUSE ms")
+			fmt.Fprintln(t, "MONITOR streams every command; run it as cache_cli MONITOR.")
+			fmt.Fprintln(t, "Type QUIT to exit.")
+			continue
+		}
+		if _, err := execute(client, t, line); err != nil {
+			return err
+		}
+	}
+}
+
+// execute sends one command and pretty-prints the reply. It reports
+// whether the server answered OK; the error is only set when the
+// connection to the server is broken.
+func execute(client *cache_client.CacheClient, w io.Writer, line string) (bool, error) {
+	command, fields := normalize(line)
+	if len(fields) == 0 {
+		return true, nil
+	}
+	// MONITOR turns the connection into a stream of echoed commands, which
+	// later replies would be mixed up with; only one-shot mode streams it.
+	if fields[0] == "MONITOR" {
+		fmt.Fprintln(w, "(error) MONITOR only runs on its own: cache_cli MONITOR")
+		return false, nil
+	}
+
+	response, err := client.Do(command)
+	if err != nil {
+		return false, fmt.Errorf("connection error: %w", err)
+	}
+	reply, err := cache_client.ParseReply(response)
+	if err != nil {
+		fmt.Fprintln(w, "(protocol error)", err)
+		return false, nil
+	}
+
+	if !reply.OK {
+		fmt.Fprintln(w, "(error)", reply.Value)
+		return false, nil
+	}
+	switch {
+	case reply.Value == "":
+		fmt.Fprintln(w, "OK")
+	case fields[0] == "CLIENT" && len(fields) > 1 && fields[1] == "LIST":
+		for i, entry := range strings.Split(reply.Value, " | ") {
+			fmt.Fprintf(w, "%d) %s\n", i+1, entry)
+		}
+	default:
+		fmt.Fprintf(w, "%q\n", reply.Value)
+	}
+	return true, nil
+}
+
+// normalize upper-cases the command and, for commands that have them, the
+// subcommand, and separates them by single spaces. The rest of the line is
+// passed through as typed, so a SET value keeps its spacing. It returns the
+// command line to send and the normalized leading tokens.
+func normalize(line string) (string, []string) {
+	rest := strings.TrimLeft(line, " \t")
+	var fields []string
+	for rest != "" && (len(fields) == 0 || len(fields) == 1 && commands[fields[0]] != nil) {
+		token, after := rest, ""
+		if i := strings.IndexAny(rest, " \t"); i >= 0 {
+			token, after = rest[:i], rest[i:]
+		}
+		fields = append(fields, strings.ToUpper(token))
+		rest = strings.TrimLeft(after, " \t")
+	}
+	command := strings.Join(fields, " ")
+	if rest != "" {
+		command += " " + rest
+	}
+	return command, fields
+}
+
+// complete implements term.Terminal's AutoCompleteCallback. On Tab it
+// completes the command name, or the subcommand after CLIENT; when the
+// prefix is ambiguous it extends it to the longest common prefix.
+func complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' || pos != len(line) {
+		return "", 0, false
+	}
+
+	fields := strings.Fields(strings.ToUpper(line))
+	var candidates []string
+	var prefix string
+	switch {
+	case len(fields) == 1 && !strings.HasSuffix(line, " "):
+		prefix = fields[0]
+		for name := range commands {
+			candidates = append(candidates, name)
+		}
+	case len(fields) == 1 && commands[fields[0]] != nil:
+		candidates = commands[fields[0]]
+	case len(fields) == 2 && !strings.HasSuffix(line, " "):
+		prefix = fields[1]
+		candidates = commands[fields[0]]
+	default:
+		return "", 0, false
+	}
+
+	var matches []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) {
+			matches = append(matches, c)
+		}
+	}
+	if len(matches) == 0 {
+		return "", 0, false
+	}
+	sort.Strings(matches)
+
+	completion := matches[0]
+	for _, m := range matches[1:] {
+		completion = commonPrefix(completion, m)
+	}
+	if len(matches) == 1 {
+		completion += " "
+	}
+
+	head := line[:len(line)-len(prefix)]
+	newLine := head + completion
+	return newLine, len(newLine), true
+}
+
+func commonPrefix(a, b string) string {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return a[:n]
+}
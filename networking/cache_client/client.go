@@ -9,9 +9,10 @@ import (
 )
 
 type CacheClient struct {
-	conn net.Conn
-	lock sync.Mutex
-	id   uint64
+	conn   net.Conn
+	reader *bufio.Reader
+	lock   sync.Mutex
+	id     uint64
 }
 
 func NewCacheClient(address string) (*CacheClient, error) {
@@ -21,8 +22,9 @@ func NewCacheClient(address string) (*CacheClient, error) {
 	}
 
 	return &CacheClient{
-		conn: conn,
-		id:   1,
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		id:     1,
 	}, nil
 }
 
@@ -41,7 +43,7 @@ func (c *CacheClient) sendCommand(command string) (string, error) {
 		return "", err
 	}
 
-	response, err := bufio.NewReader(c.conn).ReadString('\n')
+	response, err := c.reader.ReadString('\n')
 	if err != nil {
 		return "", err
 	}
@@ -49,6 +51,12 @@ func (c *CacheClient) sendCommand(command string) (string, error) {
 	return response, nil
 }
 
+// Do sends a raw command such as "CLIENT LIST" and returns the raw response.
+// Use ParseReply to split the response into its parts.
+func (c *CacheClient) Do(command string) (string, error) {
+	return c.sendCommand(command)
+}
+
 func (c *CacheClient) Set(key string, value string) (string, error) {
 	return c.sendCommand(fmt.Sprintf("SET %s %s", key, value))
 }
@@ -60,3 +68,45 @@ func (c *CacheClient) Get(key string) (string, error) {
 func (c *CacheClient) Del(key string) (string, error) {
 	return c.sendCommand(fmt.Sprintf("DEL %s", key))
 }
+
+// Monitor switches the connection into MONITOR mode and calls fn with every
+// command line the server echoes, until fn returns false or the connection
+// fails. The client must not be used for other commands afterwards.
+func (c *CacheClient) Monitor(fn func(line string) bool) error {
+	if err := c.StartMonitor(); err != nil {
+		return err
+	}
+	for {
+		line, err := c.ReadMonitorLine()
+		if err != nil {
+			return err
+		}
+		if !fn(line) {
+			return nil
+		}
+	}
+}
+
+// StartMonitor switches the connection into MONITOR mode. Once it returns,
+// every command the server receives is echoed to this connection; read the
+// lines with ReadMonitorLine. The client must not be used for other commands
+// afterwards.
+func (c *CacheClient) StartMonitor() error {
+	response, err := c.sendCommand("MONITOR")
+	if err != nil {
+		return err
+	}
+	reply, err := ParseReply(response)
+	if err != nil {
+		return err
+	}
+	return reply.Err()
+}
+
+// ReadMonitorLine blocks until the server echoes the next command to a
+// connection in MONITOR mode.
+func (c *CacheClient) ReadMonitorLine() (string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.reader.ReadString('\n')
+}
@@ -0,0 +1,54 @@
+package cache_client
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Reply is a parsed server response. Every response is a single line of the
+// form "<id> OK [value]" or "<id> ERROR <message>"; a request the server
+// cannot parse at all is answered with a bare "ERROR".
+type Reply struct {
+	ID    uint64
+	OK    bool
+	Value string // the value of an OK reply, or the message of an ERROR reply
+}
+
+// ParseReply parses a raw response line as returned by the CacheClient methods.
+func ParseReply(response string) (Reply, error) {
+	line := strings.TrimRight(response, "\r\n")
+	if line == "ERROR" {
+		return Reply{Value: "MALFORMED REQUEST"}, nil
+	}
+
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) < 2 {
+		return Reply{}, fmt.Errorf("malformed reply %q", line)
+	}
+	id, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return Reply{}, fmt.Errorf("malformed reply id %q", parts[0])
+	}
+
+	reply := Reply{ID: id}
+	if len(parts) == 3 {
+		reply.Value = parts[2]
+	}
+	switch parts[1] {
+	case "OK":
+		reply.OK = true
+	case "ERROR":
+	default:
+		return Reply{}, fmt.Errorf("malformed reply status %q", parts[1])
+	}
+	return reply, nil
+}
+
+// Err returns the reply as an error, or nil for an OK reply.
+func (r Reply) Err() error {
+	if r.OK {
+		return nil
+	}
+	return fmt.Errorf("cache: %s", r.Value)
+}
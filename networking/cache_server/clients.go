@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// clientInfo describes one accepted connection. The counters are updated
+// atomically by countingConn so CLIENT LIST never blocks a busy connection.
+type clientInfo struct {
+	id          uint64
+	conn        net.Conn
+	addr        string
+	connectedAt time.Time
+
+	bytesIn  int64
+	bytesOut int64
+
+	mu         sync.Mutex
+	name       string
+	lastCmd    string
+	lastActive time.Time
+}
+
+var (
+	clients      = make(map[uint64]*clientInfo)
+	clientsLock  = sync.RWMutex{}
+	nextClientID uint64
+
+	// pausedUntil holds the UnixNano deadline set by CLIENT PAUSE.
+	pausedUntil int64
+)
+
+// countingConn wraps a net.Conn and records the bytes read and written
+// on behalf of its client.
+type countingConn struct {
+	net.Conn
+	client *clientInfo
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	atomic.AddInt64(&c.client.bytesIn, int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	atomic.AddInt64(&c.client.bytesOut, int64(n))
+	return n, err
+}
+
+// registerClient adds a freshly accepted connection to the registry.
+func registerClient(conn net.Conn) *clientInfo {
+	now := time.Now()
+	client := &clientInfo{
+		id:          atomic.AddUint64(&nextClientID, 1),
+		addr:        conn.RemoteAddr().String(),
+		connectedAt: now,
+		lastActive:  now,
+	}
+	client.conn = &countingConn{Conn: conn, client: client}
+
+	clientsLock.Lock()
+	clients[client.id] = client
+	clientsLock.Unlock()
+	return client
+}
+
+func unregisterClient(client *clientInfo) {
+	stopMonitor(client)
+	clientsLock.Lock()
+	delete(clients, client.id)
+	clientsLock.Unlock()
+}
+
+func (c *clientInfo) touch(command string) {
+	c.mu.Lock()
+	c.lastCmd = strings.ToLower(command)
+	c.lastActive = time.Now()
+	c.mu.Unlock()
+}
+
+// String formats the client in the style of Redis' CLIENT LIST.
+func (c *clientInfo) String() string {
+	c.mu.Lock()
+	name, lastCmd, lastActive := c.name, c.lastCmd, c.lastActive
+	c.mu.Unlock()
+
+	now := time.Now()
+	return fmt.Sprintf("id=%d addr=%s name=%s age=%d idle=%d cmd=%s in=%d out=%d",
+		c.id, c.addr, name,
+		int(now.Sub(c.connectedAt).Seconds()),
+		int(now.Sub(lastActive).Seconds()),
+		lastCmd,
+		atomic.LoadInt64(&c.bytesIn),
+		atomic.LoadInt64(&c.bytesOut))
+}
+
+// waitIfPaused blocks while a CLIENT PAUSE is in effect.
+func waitIfPaused() {
+	for {
+		remaining := time.Until(time.Unix(0, atomic.LoadInt64(&pausedUntil)))
+		if remaining <= 0 {
+			return
+		}
+		time.Sleep(remaining)
+	}
+}
+
+// processClientCommand handles the CLIENT family of commands:
+//
+//	CLIENT LIST
+//	CLIENT SETNAME <name>
+//	CLIENT GETNAME
+//	CLIENT KILL <id|addr>
+//	CLIENT PAUSE <milliseconds>
+//
+// CLIENT LIST replies on a single line with the clients separated by " | ",
+// since every reply in this protocol is exactly one line.
+func processClientCommand(client *clientInfo, id, subcommand, arg string) {
+	conn := client.conn
+
+	switch strings.ToUpper(subcommand) {
+	case "LIST":
+		clientsLock.RLock()
+		list := make([]*clientInfo, 0, len(clients))
+		for _, c := range clients {
+			list = append(list, c)
+		}
+		clientsLock.RUnlock()
+
+		sort.Slice(list, func(i, j int) bool { return list[i].id < list[j].id })
+		entries := make([]string, len(list))
+		for i, c := range list {
+			entries[i] = c.String()
+		}
+		fmt.Fprintf(conn, "%s OK %s\n", id, strings.Join(entries, " | "))
+	case "SETNAME":
+		if arg == "" || strings.ContainsAny(arg, " |") {
+			fmt.Fprintf(conn, "%s ERROR INVALID NAME\n", id)
+			return
+		}
+		client.mu.Lock()
+		client.name = arg
+		client.mu.Unlock()
+		fmt.Fprintf(conn, "%s OK\n", id)
+	case "GETNAME":
+		client.mu.Lock()
+		name := client.name
+		client.mu.Unlock()
+		fmt.Fprintf(conn, "%s OK %s\n", id, name)
+	case "KILL":
+		target := findClient(arg)
+		if target == nil {
+			fmt.Fprintf(conn, "%s ERROR NO SUCH CLIENT\n", id)
+			return
+		}
+		fmt.Fprintf(conn, "%s OK\n", id)
+		// Closing the connection makes the target's read loop fail, which
+		// unregisters it.
+		target.conn.Close()
+	case "PAUSE":
+		ms, err := strconv.Atoi(arg)
+		if err != nil || ms < 0 {
+			fmt.Fprintf(conn, "%s ERROR INVALID TIMEOUT\n", id)
+			return
+		}
+		deadline := time.Now().Add(time.Duration(ms) * time.Millisecond)
+		atomic.StoreInt64(&pausedUntil, deadline.UnixNano())
+		fmt.Fprintf(conn, "%s OK\n", id)
+	default:
+		fmt.Fprintf(conn, "%s ERROR UNKNOWN SUBCOMMAND\n", id)
+	}
+}
+
+// findClient looks a client up by its numeric id or its remote address.
+func findClient(target string) *clientInfo {
+	clientsLock.RLock()
+	defer clientsLock.RUnlock()
+
+	if n, err := strconv.ParseUint(target, 10, 64); err == nil {
+		if c, ok := clients[n]; ok {
+			return c
+		}
+	}
+	for _, c := range clients {
+		if c.addr == target {
+			return c
+		}
+	}
+	return nil
+}
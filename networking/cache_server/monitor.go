@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// monitorBuffer is how many lines a slow MONITOR connection may fall behind
+// before lines are dropped for it. Command processing never waits on a
+// monitor.
+const monitorBuffer = 4096
+
+var (
+	monitors      = make(map[uint64]chan string)
+	monitorsLock  = sync.RWMutex{}
+	monitorsCount int64
+)
+
+// startMonitor turns the client into a monitor: from now on every command
+// received by the server is echoed to it as a line of the form
+//
+//	<unix time with microseconds> [<client id> <addr>] <command>
+//
+// The lines can be replayed with cache_bench -trace. reply, the answer to
+// the MONITOR command, is queued ahead of the first echoed line so that no
+// line can overtake it.
+func startMonitor(client *clientInfo, reply string) {
+	monitorsLock.Lock()
+	lines, ok := monitors[client.id]
+	if ok {
+		monitorsLock.Unlock()
+		// Only the client's own connection handler, which is running
+		// this command, stops its feed, so it cannot be closed under us.
+		lines <- reply
+		return
+	}
+
+	lines = make(chan string, monitorBuffer)
+	lines <- reply
+	monitors[client.id] = lines
+	atomic.AddInt64(&monitorsCount, 1)
+	monitorsLock.Unlock()
+
+	go func() {
+		for line := range lines {
+			if _, err := client.conn.Write([]byte(line)); err != nil {
+				return
+			}
+		}
+	}()
+}
+
+func stopMonitor(client *clientInfo) {
+	monitorsLock.Lock()
+	defer monitorsLock.Unlock()
+	if lines, ok := monitors[client.id]; ok {
+		delete(monitors, client.id)
+		atomic.AddInt64(&monitorsCount, -1)
+		close(lines)
+	}
+}
+
+// feedMonitors echoes a command to every monitor.
+func feedMonitors(client *clientInfo, command string) {
+	if atomic.LoadInt64(&monitorsCount) == 0 {
+		return
+	}
+
+	now := time.Now()
+	line := fmt.Sprintf("%d.%06d [%d %s] %s\n",
+		now.Unix(), now.Nanosecond()/1000, client.id, client.addr, command)
+
+	monitorsLock.RLock()
+	defer monitorsLock.RUnlock()
+	for _, lines := range monitors {
+		select {
+		case lines <- line:
+		default:
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"net"
 	"strings"
@@ -13,9 +14,10 @@ var (
 	lock      = sync.RWMutex{}
 )
 
-func handleConnection(conn net.Conn) {
-	defer conn.Close()
-	reader := bufio.NewReader(conn)
+func handleConnection(client *clientInfo) {
+	defer unregisterClient(client)
+	defer client.conn.Close()
+	reader := bufio.NewReader(client.conn)
 
 	for {
 		message, err := reader.ReadString('\n')
@@ -23,13 +25,19 @@ func handleConnection(conn net.Conn) {
 			fmt.Println("Error reading:", err.Error())
 			break
 		}
-		processCommand(conn, message)
+		processCommand(client, message)
 	}
 }
 
-func processCommand(conn net.Conn, commandStr string) {
+func processCommand(client *clientInfo, commandStr string) {
+	conn := client.conn
 	commandStr = strings.TrimSpace(commandStr)
 	parts := strings.SplitN(commandStr, " ", 4)
+	if len(parts) == 2 && parts[1] == "MONITOR" {
+		client.touch(parts[1])
+		startMonitor(client, parts[0]+" OK\n")
+		return
+	}
 	if len(parts) < 3 {
 		fmt.Fprintf(conn, "ERROR\n")
 		return
@@ -42,12 +50,28 @@ func processCommand(conn net.Conn, commandStr string) {
 	}
 
 	fmt.Println("Command:",  command);
-	
+	client.touch(command)
+	echo := strings.Join(parts[1:], " ")
+	// Writes are echoed once they have been applied, under the data lock,
+	// so a monitor that sees one can rely on reads no longer returning the
+	// old value. Everything else is echoed as it arrives.
+	if command != "SET" && command != "DEL" {
+		feedMonitors(client, echo)
+	}
+
+	// CLIENT commands are exempt from CLIENT PAUSE so an operator can still
+	// inspect and kill connections while the server is paused.
+	if command == "CLIENT" {
+		processClientCommand(client, id, key, value)
+		return
+	}
+	waitIfPaused()
 
 	switch command {
 		case "SET":
 			lock.Lock()
 			dataStore[key] = value
+			feedMonitors(client, echo)
 			lock.Unlock()
 			fmt.Fprintf(conn, "%s OK\n", id)
 		case "GET":
@@ -59,19 +83,33 @@ func processCommand(conn net.Conn, commandStr string) {
 				return
 			}
 			fmt.Fprintf(conn, "%s OK %s\n", id, val)
+		case "DEL":
+			lock.Lock()
+			_, ok := dataStore[key]
+			delete(dataStore, key)
+			feedMonitors(client, echo)
+			lock.Unlock()
+			if !ok {
+				fmt.Fprintf(conn, "%s ERROR NOT FOUND\n", id)
+				return
+			}
+			fmt.Fprintf(conn, "%s OK\n", id)
 		default:
 			fmt.Fprintf(conn, "%s ERROR UNKNOWN COMMAND\n", id)
 		}
 }
 
 func main() {
-	ln, err := net.Listen("tcp", ":7070")
+	addr := flag.String("addr", ":7070", "address to listen on")
+	flag.Parse()
+
+	ln, err := net.Listen("tcp", *addr)
 	if err != nil {
 		fmt.Println("Error listening:", err.Error())
 		return
 	}
 	defer ln.Close()
-	fmt.Println("Cache server running on port 7070")
+	fmt.Println("Cache server running on", ln.Addr())
 
 	for {
 		conn, err := ln.Accept()
@@ -79,6 +117,6 @@ func main() {
 			fmt.Println("Error accepting:", err.Error())
 			return
 		}
-		go handleConnection(conn)
+		go handleConnection(registerClient(conn))
 	}
 }
@@ -0,0 +1,70 @@
+// Run the cache server first:
+//
+//	go run ./networking/cache_server
+//	go run ./networking/near_cache/example
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go-cookbook/networking/cache_client"
+	"go-cookbook/networking/near_cache"
+)
+
+const addr = "localhost:7070"
+
+func main() {
+	writer, err := cache_client.NewCacheClient(addr)
+	if err != nil {
+		fmt.Println("Error connecting to the cache server:", err)
+		return
+	}
+	defer writer.Close()
+
+	// Read-through: the first Get goes to the server, the rest are served
+	// from memory.
+	plain, err := near_cache.New(addr, 500*time.Millisecond)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	defer plain.Close()
+
+	plain.Set("greeting", "hello")
+	for i := 0; i < 100; i++ {
+		plain.Get("greeting")
+	}
+	fmt.Printf("Local hit ratio: %.2f\n", plain.LocalStats().HitRatio())
+
+	// Without invalidation another client's write is only seen once the
+	// local TTL has passed.
+	writer.Set("greeting", "bonjour")
+	value, _ := plain.Get("greeting")
+	fmt.Println("Right after another client's SET:", value)
+	time.Sleep(600 * time.Millisecond)
+	value, _ = plain.Get("greeting")
+	fmt.Println("After the local TTL:", value)
+
+	// With invalidation the MONITOR feed drops the key almost immediately.
+	invalidated, err := near_cache.New(addr, time.Minute, near_cache.WithInvalidation())
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	defer invalidated.Close()
+
+	time.Sleep(100 * time.Millisecond) // let the feed subscribe
+	invalidated.Get("greeting")
+	writer.Set("greeting", "hola")
+	time.Sleep(50 * time.Millisecond)
+	value, _ = invalidated.Get("greeting")
+	fmt.Println("With invalidation, 50ms after another client's SET:", value)
+
+	writer.Del("greeting")
+	time.Sleep(50 * time.Millisecond)
+	if _, err := invalidated.Get("greeting"); errors.Is(err, near_cache.ErrNotFound) {
+		fmt.Println("After DEL: not found")
+	}
+}
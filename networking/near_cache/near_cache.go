@@ -0,0 +1,277 @@
+// Package near_cache puts a small in-process cache (L1) in front of the TCP
+// cache server (L2), so hot keys are read from memory instead of over the
+// network on every request.
+//
+// Reads go through L1 and fall back to the server on a miss (read-through);
+// writes go to the server first and then to L1 (write-through). Entries live
+// in L1 for a short local TTL only.
+//
+// # Consistency
+//
+// Without invalidation a near cache can serve a value up to the local TTL
+// after another client changed it on the server. That is the whole price of
+// the near cache, and the TTL is the knob: shorter means fresher and more
+// server round trips.
+//
+// WithInvalidation subscribes to the server's MONITOR feed on a second
+// connection and drops a key from L1 as soon as any client SETs or DELs it.
+// The server echoes a SET or DEL only once it has been applied, so the
+// invalidation always follows any read that could have seen the old value,
+// and removes that value from L1 if the read cached it. That shrinks the
+// window to roughly one network hop, but it does not make the near cache
+// strongly consistent:
+//
+//   - A read served from L1 between the write and the arrival of its
+//     invalidation still returns the old value.
+//   - The server drops MONITOR lines for a subscriber that falls too far
+//     behind, so an invalidation can be lost under heavy write load.
+//   - Invalidations are counted globally, so under a steady stream of
+//     writes to any key L1 fills less often.
+//   - While the feed is disconnected L1 is cleared and bypassed; it is
+//     reconnected in the background.
+//
+// In every case the local TTL is the upper bound on staleness, so keep it
+// short even with invalidation enabled.
+package near_cache
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-cookbook/networking/cache_client"
+	cache "go-cookbook/projects/thread-safe-cache"
+)
+
+// ErrNotFound is returned by Get and Del for a key the server does not have.
+var ErrNotFound = errors.New("near_cache: key not found")
+
+// feedRetry is how long the invalidation feed waits before reconnecting.
+const feedRetry = time.Second
+
+type options struct {
+	invalidation bool
+	maxEntries   int64
+}
+
+// Option configures a NearCache.
+type Option func(*options)
+
+// WithInvalidation drops keys from the local cache when any client changes
+// them on the server, using the server's MONITOR feed.
+func WithInvalidation() Option {
+	return func(o *options) {
+		o.invalidation = true
+	}
+}
+
+// WithMaxEntries bounds the local cache to n entries, evicting the least
+// recently used ones.
+func WithMaxEntries(n int64) Option {
+	return func(o *options) {
+		o.maxEntries = n
+	}
+}
+
+// NearCache is a two-level cache client. It is safe for concurrent use; the
+// server connection is shared, so requests that miss L1 are serialized.
+type NearCache struct {
+	address string
+	local   *cache.Cache[string, string]
+	remote  *cache_client.CacheClient
+
+	invalidation bool
+	subscribed   atomic.Bool   // the feed is connected and monitoring
+	generation   atomic.Uint64 // bumped by every invalidation
+
+	feedMu  sync.Mutex
+	feed    *cache_client.CacheClient
+	closing chan struct{}
+	done    chan struct{}
+	close   sync.Once
+}
+
+// New connects to the cache server at address. Values are kept locally for
+// localTTL.
+func New(address string, localTTL time.Duration, opts ...Option) (*NearCache, error) {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	remote, err := cache_client.NewCacheClient(address)
+	if err != nil {
+		return nil, err
+	}
+
+	var localOpts []cache.Option
+	if o.maxEntries > 0 {
+		localOpts = append(localOpts, cache.WithMaxCost(o.maxEntries))
+	}
+	n := &NearCache{
+		address:      address,
+		local:        cache.New[string, string](localTTL, localOpts...),
+		remote:       remote,
+		invalidation: o.invalidation,
+		closing:      make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	if n.invalidation {
+		go n.watch()
+	} else {
+		close(n.done)
+	}
+	return n, nil
+}
+
+// Close closes both connections and stops the local cache.
+func (n *NearCache) Close() {
+	n.close.Do(func() {
+		close(n.closing)
+		n.feedMu.Lock()
+		if n.feed != nil {
+			n.feed.Close()
+		}
+		n.feedMu.Unlock()
+		<-n.done
+		n.remote.Close()
+		n.local.Close()
+	})
+}
+
+// Get returns the value of key, from the local cache if possible.
+func (n *NearCache) Get(key string) (string, error) {
+	if value, found := n.local.Get(key); found {
+		return value, nil
+	}
+
+	generation := n.generation.Load()
+	reply, err := n.do(n.remote.Get(key))
+	if err != nil {
+		return "", err
+	}
+	n.store(key, reply.Value, generation)
+	return reply.Value, nil
+}
+
+// Set stores value under key on the server and then locally.
+func (n *NearCache) Set(key, value string) error {
+	generation := n.generation.Load()
+	if _, err := n.do(n.remote.Set(key, value)); err != nil {
+		// The server may or may not have applied the write.
+		n.local.Delete(key)
+		return err
+	}
+	n.store(key, value, generation)
+	return nil
+}
+
+// Del deletes key on the server and locally.
+func (n *NearCache) Del(key string) error {
+	n.local.Delete(key)
+	_, err := n.do(n.remote.Del(key))
+	return err
+}
+
+// LocalStats returns the statistics of the local cache; its hit ratio is the
+// share of reads that did not reach the server.
+func (n *NearCache) LocalStats() cache.Stats {
+	return n.local.Stats()
+}
+
+func (n *NearCache) do(response string, err error) (cache_client.Reply, error) {
+	if err != nil {
+		return cache_client.Reply{}, err
+	}
+	reply, err := cache_client.ParseReply(response)
+	if err != nil {
+		return cache_client.Reply{}, err
+	}
+	if !reply.OK && reply.Value == "NOT FOUND" {
+		return reply, ErrNotFound
+	}
+	return reply, reply.Err()
+}
+
+// store puts a value read or written at generation into the local cache,
+// unless an invalidation arrived in the meantime or the feed is down.
+func (n *NearCache) store(key, value string, generation uint64) {
+	if n.invalidation && !n.subscribed.Load() {
+		return
+	}
+	n.local.Set(key, value)
+	if n.generation.Load() != generation {
+		// An invalidation raced the request; the value may be stale.
+		n.local.Delete(key)
+	}
+}
+
+func (n *NearCache) invalidate(key string) {
+	n.generation.Add(1)
+	n.local.Delete(key)
+}
+
+// watch follows the server's MONITOR feed until Close, reconnecting when
+// the connection fails.
+func (n *NearCache) watch() {
+	defer close(n.done)
+	for {
+		feed, err := cache_client.NewCacheClient(n.address)
+		if err == nil {
+			n.feedMu.Lock()
+			select {
+			case <-n.closing:
+				n.feedMu.Unlock()
+				feed.Close()
+				return
+			default:
+			}
+			n.feed = feed
+			n.feedMu.Unlock()
+
+			if err = feed.StartMonitor(); err == nil {
+				n.subscribed.Store(true)
+				n.follow(feed)
+			}
+			feed.Close()
+		}
+
+		// Invalidations may have been missed; nothing in L1 can be trusted.
+		n.subscribed.Store(false)
+		n.generation.Add(1)
+		n.local.Clear()
+
+		select {
+		case <-n.closing:
+			return
+		case <-time.After(feedRetry):
+		}
+	}
+}
+
+// follow invalidates the key of every SET and DEL echoed on the feed. A line
+// looks like
+//
+//	1700000000.123456 [3 127.0.0.1:51234] SET key value
+func (n *NearCache) follow(feed *cache_client.CacheClient) {
+	for {
+		line, err := feed.ReadMonitorLine()
+		if err != nil {
+			return
+		}
+		_, command, found := strings.Cut(strings.TrimSpace(line), "] ")
+		if !found {
+			continue
+		}
+		fields := strings.SplitN(command, " ", 3)
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "SET", "DEL":
+			n.invalidate(fields[1])
+		}
+	}
+}
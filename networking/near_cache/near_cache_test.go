@@ -0,0 +1,275 @@
+package near_cache
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-cookbook/networking/cache_client"
+)
+
+// serverAddr is the address of the cache server that TestMain builds and
+// starts for the tests.
+var serverAddr string
+
+func TestMain(m *testing.M) {
+	stop, err := startServer()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "starting the cache server:", err)
+		os.Exit(1)
+	}
+	code := m.Run()
+	stop()
+	os.Exit(code)
+}
+
+func startServer() (func(), error) {
+	dir, err := os.MkdirTemp("", "near_cache_test")
+	if err != nil {
+		return nil, err
+	}
+	binary := filepath.Join(dir, "cache_server")
+	build := exec.Command("go", "build", "-o", binary, "go-cookbook/networking/cache_server")
+	if out, err := build.CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("%v\n%s", err, out)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	serverAddr = ln.Addr().String()
+	ln.Close()
+
+	server := exec.Command(binary, "-addr", serverAddr)
+	if err := server.Start(); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	stop := func() {
+		server.Process.Kill()
+		server.Wait()
+		os.RemoveAll(dir)
+	}
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		conn, err := net.Dial("tcp", serverAddr)
+		if err == nil {
+			conn.Close()
+			return stop, nil
+		}
+		if time.Since(start) > 5*time.Second {
+			stop()
+			return nil, err
+		}
+	}
+}
+
+func newNearCache(t *testing.T, localTTL time.Duration, opts ...Option) *NearCache {
+	t.Helper()
+	n, err := New(serverAddr, localTTL, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(n.Close)
+	return n
+}
+
+// newWriter connects a plain client, standing in for another process that
+// changes the server behind the near cache's back.
+func newWriter(t *testing.T) *cache_client.CacheClient {
+	t.Helper()
+	c, err := cache_client.NewCacheClient(serverAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	return c
+}
+
+// waitSubscribed waits until the invalidation feed is following MONITOR.
+func waitSubscribed(t *testing.T, n *NearCache) {
+	t.Helper()
+	for start := time.Now(); !n.subscribed.Load(); time.Sleep(5 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("the invalidation feed did not subscribe")
+		}
+	}
+}
+
+// eventually polls get until it returns want or the timeout passes.
+func eventually(t *testing.T, timeout time.Duration, get func() (string, error), want string) {
+	t.Helper()
+	var got string
+	var err error
+	for start := time.Now(); time.Since(start) < timeout; time.Sleep(5 * time.Millisecond) {
+		if got, err = get(); err == nil && got == want {
+			return
+		}
+	}
+	t.Fatalf("got %q, %v; want %q", got, err, want)
+}
+
+func TestReadThrough(t *testing.T) {
+	n := newNearCache(t, time.Minute)
+	key := t.Name()
+	if err := n.Set(key, "v1"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		got, err := n.Get(key)
+		if err != nil || got != "v1" {
+			t.Fatalf("Get = %q, %v; want v1", got, err)
+		}
+	}
+	if stats := n.LocalStats(); stats.Hits != 10 || stats.Misses != 0 {
+		t.Errorf("local hits/misses = %d/%d, want 10/0", stats.Hits, stats.Misses)
+	}
+
+	if _, err := n.Get(key + ":missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a missing key: %v, want ErrNotFound", err)
+	}
+}
+
+func TestStaleUntilLocalTTLWithoutInvalidation(t *testing.T) {
+	const ttl = 200 * time.Millisecond
+	n := newNearCache(t, ttl)
+	writer := newWriter(t)
+	key := t.Name()
+
+	n.Set(key, "old")
+	writer.Set(key, "new")
+	if got, _ := n.Get(key); got != "old" {
+		t.Errorf("Get right after another client's SET = %q, want the stale %q", got, "old")
+	}
+	time.Sleep(ttl + 50*time.Millisecond)
+	if got, _ := n.Get(key); got != "new" {
+		t.Errorf("Get after the local TTL = %q, want %q", got, "new")
+	}
+}
+
+func TestInvalidation(t *testing.T) {
+	n := newNearCache(t, time.Minute, WithInvalidation())
+	waitSubscribed(t, n)
+	writer := newWriter(t)
+	key := t.Name()
+
+	n.Set(key, "old")
+	writer.Set(key, "new")
+	eventually(t, time.Second, func() (string, error) { return n.Get(key) }, "new")
+
+	writer.Del(key)
+	var err error
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(5 * time.Millisecond) {
+		if _, err = n.Get(key); errors.Is(err, ErrNotFound) {
+			return
+		}
+	}
+	t.Errorf("Get after another client's DEL: %v, want ErrNotFound", err)
+}
+
+// TestReadsRacingWrites checks that a read racing a write never leaves the
+// old value in L1 once the write's invalidation has arrived. That relies on
+// the server echoing a write only after applying it; if it echoed first, a
+// read landing in between would cache the old value with nothing left to
+// invalidate it.
+func TestReadsRacingWrites(t *testing.T) {
+	n := newNearCache(t, time.Minute, WithInvalidation())
+	waitSubscribed(t, n)
+	writer := newWriter(t)
+	key := t.Name()
+
+	for i := 0; i < 50; i++ {
+		want := fmt.Sprint(i)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			writer.Set(key, want)
+		}()
+	reading:
+		for {
+			select {
+			case <-done:
+				break reading
+			default:
+				n.Get(key)
+			}
+		}
+
+		// Give the invalidation time to arrive; after that every read must
+		// be fresh.
+		time.Sleep(20 * time.Millisecond)
+		if got, _ := n.Get(key); got != want {
+			t.Fatalf("write %d: Get = %q after the invalidation, want %q", i, got, want)
+		}
+	}
+}
+
+// TestFeedDisconnect checks that L1 is cleared and bypassed while the
+// invalidation feed is down, and used again once it has reconnected.
+func TestFeedDisconnect(t *testing.T) {
+	n := newNearCache(t, time.Minute, WithInvalidation())
+	waitSubscribed(t, n)
+	writer := newWriter(t)
+	key := t.Name()
+
+	n.Set(key, "old")
+	killMonitors(t, writer)
+	for start := time.Now(); n.subscribed.Load(); time.Sleep(5 * time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatal("the feed did not notice it was disconnected")
+		}
+	}
+
+	// Nobody would tell us about this write.
+	writer.Set(key, "new")
+	if got, _ := n.Get(key); got != "new" {
+		t.Errorf("Get with the feed down = %q, want %q", got, "new")
+	}
+	if n.local.Len() != 0 {
+		t.Errorf("L1 holds %d entries with the feed down, want 0", n.local.Len())
+	}
+
+	waitSubscribed(t, n)
+	n.Get(key)
+	before := n.LocalStats().Hits
+	n.Get(key)
+	if n.LocalStats().Hits != before+1 {
+		t.Error("L1 is not used again after the feed reconnected")
+	}
+}
+
+// killMonitors closes every MONITOR connection on the server.
+func killMonitors(t *testing.T, c *cache_client.CacheClient) {
+	t.Helper()
+	response, err := c.Do("CLIENT LIST")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := cache_client.ParseReply(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	killed := 0
+	for _, entry := range strings.Split(reply.Value, " | ") {
+		if !strings.Contains(entry, "cmd=monitor") {
+			continue
+		}
+		for _, field := range strings.Fields(entry) {
+			if id, ok := strings.CutPrefix(field, "id="); ok {
+				c.Do("CLIENT KILL " + id)
+				killed++
+			}
+		}
+	}
+	if killed == 0 {
+		t.Fatalf("no MONITOR connection in %q", reply.Value)
+	}
+}
@@ -0,0 +1,532 @@
+// Question 4: Building a Thread-Safe In-Memory Cache
+// Design and implement a thread-safe in-memory cache in Go. The cache should provide basic operations (Get, Set, Delete) and support expiration of items. Describe your design choices regarding concurrency control and eviction strategy."
+
+// Package cache is a thread-safe in-memory cache with expiring items.
+// See example/main.go for a runnable demo.
+package cache
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+)
+
+const (
+	// NoExpiration marks an item (or, passed to New, every item by default)
+	// as never expiring.
+	NoExpiration time.Duration = -1
+	// DefaultExpiration tells SetWithTTL to use the TTL the cache was
+	// created with.
+	DefaultExpiration time.Duration = 0
+)
+
+// janitorBatch bounds how many expired items the janitor removes per lock
+// acquisition, so a mass expiry cannot stall readers and writers for long.
+const janitorBatch = 1024
+
+type cacheItem[K comparable, V any] struct {
+	key        K
+	value      V
+	expiration int64         // UnixNano deadline, 0 if the item never expires
+	softExpiry int64         // UnixNano deadline after which the item is stale, 0 if never
+	ttl        time.Duration // the item's TTL, used to extend sliding deadlines
+	heapIndex  int           // position in Cache.expiry, -1 if not in it
+	version    uint64        // changes whenever a value is stored, see setLocked
+
+	tags []string // see SetWithTags
+
+	// Used by bounded caches only, see capacity.go.
+	cost       int64
+	prev, next *cacheItem[K, V]
+}
+
+func (item *cacheItem[K, V]) expired(now int64) bool {
+	return item.expiration != 0 && now > item.expiration
+}
+
+func (item *cacheItem[K, V]) stale(now int64) bool {
+	return item.softExpiry != 0 && now > item.softExpiry
+}
+
+// Cache maps keys of type K to values of type V. By default every item
+// expires ttl after it was last set; SetWithTTL overrides that per item. A
+// Cache is safe for concurrent use by multiple goroutines.
+//
+// A background goroutine (the janitor) removes expired items; call Close
+// when the cache is no longer needed to stop it.
+type Cache[K comparable, V any] struct {
+	items   map[K]*cacheItem[K, V]
+	expiry  expiryHeap[K, V]
+	mu      sync.RWMutex
+	ttl     time.Duration
+	sliding bool
+	closed  bool
+
+	versions uint64 // the last version given to an item
+
+	onEvicted func(K, V, EvictionReason)
+	stats     counters
+
+	// Capacity, see WithMaxCost.
+	maxCost  int64
+	usedCost int64
+	cost     func(K, V) int64
+	lru      cacheItem[K, V] // sentinel of the recency list
+	sketch   *countMinSketch // nil without WithTinyLFU
+
+	// Secondary indexes, see tags.go. prefixes is nil without
+	// WithPrefixIndex.
+	tags     map[string]map[K]struct{}
+	prefixes *keyTrie
+
+	// Snapshots, see Save and WithAutoSave.
+	codec          Codec
+	autoSave       string
+	onPersistError func(error)
+
+	// In-flight and failed loads of GetOrLoad, guarded by loadMu.
+	loadMu      sync.Mutex
+	loads       map[K]*loadCall[V]
+	negatives   map[K]negativeEntry
+	negativeTTL time.Duration
+
+	// Stale-while-revalidate, see WithSoftTTL. loader and refreshing are
+	// guarded by loadMu.
+	loader     func(context.Context, K) (V, error)
+	softTTL    time.Duration
+	refreshing map[K]struct{}
+	refreshSem chan struct{}
+	refreshes  sync.WaitGroup
+
+	ctx    context.Context // done once the cache is closed
+	cancel context.CancelFunc
+	done   chan struct{} // closed when the janitor has exited
+}
+
+// New returns an empty cache whose items expire after ttl. Pass NoExpiration
+// to keep items until they are deleted, unless SetWithTTL says otherwise.
+func New[K comparable, V any](ttl time.Duration, opts ...Option) *Cache[K, V] {
+	return NewWithContext[K, V](context.Background(), ttl, opts...)
+}
+
+// NewWithContext is like New, but the cache is also closed when ctx is done.
+func NewWithContext[K comparable, V any](ctx context.Context, ttl time.Duration, opts ...Option) *Cache[K, V] {
+	// &Cache[K, V]{...}:
+	// The & operator returns the memory address of the struct literal being defined. This means you're creating a new Cache struct and then taking its pointer.
+
+	// items: make(map[K]*cacheItem[K, V])
+	// This initializes the items field with a new empty map. Because Cache is generic, the key and value types are chosen by the caller, e.g. New[string, int](time.Minute), and Get returns a V without any type assertion.
+
+	// ttl: ttl
+	// This sets the ttl field of the struct to the value of the variable ttl that's passed into the context.
+
+	// Result:
+	// The variable c is of type *Cache[K, V] (a pointer to a Cache struct). Using a pointer allows you to modify the struct's fields across different parts of your program without copying the entire struct.
+
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if ttl <= 0 {
+		ttl = NoExpiration
+	}
+	if o.maxRefreshes <= 0 {
+		o.maxRefreshes = defaultMaxRefreshes
+	}
+	if o.codec == nil {
+		o.codec = GobCodec
+	}
+	if o.cleanupInterval <= 0 {
+		o.cleanupInterval = ttl
+		if ttl == NoExpiration {
+			o.cleanupInterval = time.Minute
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	c := &Cache[K, V]{
+		items:   make(map[K]*cacheItem[K, V]),
+		ttl:     ttl,
+		sliding: o.sliding,
+
+		maxCost: o.maxCost,
+
+		tags: make(map[string]map[K]struct{}),
+
+		codec:          o.codec,
+		autoSave:       o.autoSave,
+		onPersistError: o.onPersistError,
+
+		loads:       make(map[K]*loadCall[V]),
+		negatives:   make(map[K]negativeEntry),
+		negativeTTL: o.negativeTTL,
+
+		softTTL:    o.softTTL,
+		refreshing: make(map[K]struct{}),
+		refreshSem: make(chan struct{}, o.maxRefreshes),
+
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	c.lruInit()
+	if o.tinyLFU > 0 && c.bounded() {
+		c.sketch = newCountMinSketch(o.tinyLFU)
+	}
+	if o.prefixIndex {
+		if _, ok := any(*new(K)).(string); !ok {
+			panic("cache: WithPrefixIndex requires string keys")
+		}
+		c.prefixes = &keyTrie{}
+	}
+	if c.autoSave != "" {
+		c.restore()
+	}
+	go c.startEviction(ctx, o.cleanupInterval)
+	return c
+}
+
+// Close stops the janitor and removes every item, reporting them to the
+// OnEvicted callback as deleted. With WithAutoSave the items are saved
+// first. It waits for the janitor and any background
+// refreshes to finish and is safe to call more than once.
+//
+// A closed cache is empty and stays empty: Set is a no-op and Get always
+// reports a miss.
+func (c *Cache[K, V]) Close() {
+	c.cancel()
+	<-c.done
+}
+
+// Set stores value under key with the cache's default TTL, replacing any
+// previous value.
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, DefaultExpiration)
+}
+
+// SetWithTTL stores value under key with its own TTL. Use DefaultExpiration
+// for the cache's TTL and NoExpiration for an item that never expires.
+//
+// In a bounded cache the value is not stored if its cost alone exceeds the
+// maximum, or if the admission filter turns it away. Tags of a previous
+// value are dropped; see SetWithTags.
+func (c *Cache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	c.SetWithTags(key, value, ttl)
+}
+
+// setLocked stores value under key and returns the stored item, or nil if
+// a bounded cache refused it. It must be called with c.mu held.
+func (c *Cache[K, V]) setLocked(key K, value V, ttl time.Duration, now time.Time, evicted []eviction[K, V]) ([]eviction[K, V], *cacheItem[K, V]) {
+	if ttl == DefaultExpiration {
+		ttl = c.ttl
+	}
+	var expiration, softExpiry int64
+	if ttl > 0 {
+		expiration = now.Add(ttl).UnixNano()
+	}
+	if c.softTTL > 0 && (ttl <= 0 || c.softTTL < ttl) {
+		softExpiry = now.Add(c.softTTL).UnixNano()
+	}
+
+	item, exists := c.items[key]
+	var cost int64
+	if c.bounded() {
+		if c.sketch != nil {
+			c.sketch.increment(hashKey(key))
+		}
+		cost = c.costOf(key, value)
+		ok := cost <= c.maxCost
+		if ok {
+			evicted, ok = c.makeRoomLocked(key, item, cost, evicted)
+		}
+		if !ok {
+			c.stats.rejections.Add(1)
+			if exists {
+				// The old value must not outlive a newer Set.
+				c.removeLocked(item)
+				evicted = c.evictedLocked(evicted, item, ReasonReplaced)
+			}
+			return evicted, nil
+		}
+	}
+
+	if exists {
+		reason := ReasonReplaced
+		if item.expired(now.UnixNano()) {
+			reason = ReasonExpired
+		}
+		evicted = c.evictedLocked(evicted, item, reason)
+	} else {
+		item = &cacheItem[K, V]{key: key, heapIndex: -1}
+		c.items[key] = item
+		if c.prefixes != nil {
+			c.prefixes.insert(any(key).(string))
+		}
+	}
+	c.versions++
+	item.value = value
+	item.version = c.versions
+	item.ttl = ttl
+	item.expiration = expiration
+	item.softExpiry = softExpiry
+	c.expiry.update(item)
+	if c.bounded() {
+		c.usedCost += cost - item.cost
+		item.cost = cost
+		c.lruMoveToFront(item)
+	}
+	c.stats.sets.Add(1)
+	return evicted, item
+}
+
+// removeLocked unlinks item from every index. It must be called with c.mu
+// held.
+func (c *Cache[K, V]) removeLocked(item *cacheItem[K, V]) {
+	delete(c.items, item.key)
+	c.expiry.remove(item)
+	c.untagLocked(item)
+	if c.prefixes != nil {
+		c.prefixes.remove(any(item.key).(string))
+	}
+	if c.bounded() {
+		c.lruRemove(item)
+		c.usedCost -= item.cost
+	}
+}
+
+// Get returns the value stored under key and whether it was found. Expired
+// items are never returned, even before the janitor has removed them.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	value, _, ok := c.GetWithExpiration(key)
+	return value, ok
+}
+
+// GetWithExpiration is like Get but also returns how long the item has left
+// to live, or NoExpiration if it never expires. With sliding expiration the
+// remaining lifetime is the item's full TTL, since the read extended it.
+//
+// With WithSoftTTL a stale item is still returned, and a background refresh
+// is started for it.
+func (c *Cache[K, V]) GetWithExpiration(key K) (V, time.Duration, bool) {
+	now := time.Now().UnixNano()
+	item, ok := c.lookup(key, now)
+	if !ok {
+		c.stats.misses.Add(1)
+		var zero V
+		return zero, 0, false
+	}
+	c.stats.hits.Add(1)
+	if item.stale(now) {
+		c.refreshAhead(key, item)
+	}
+	if item.expiration == 0 {
+		return item.value, NoExpiration, true
+	}
+	return item.value, time.Duration(item.expiration - now), true
+}
+
+// lookup returns a copy of the unexpired item stored under key, first
+// extending its deadline if expiration is sliding.
+func (c *Cache[K, V]) lookup(key K, now int64) (cacheItem[K, V], bool) {
+	if c.sliding || c.bounded() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+	} else {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+	}
+
+	if c.sketch != nil {
+		c.sketch.increment(hashKey(key))
+	}
+	item, exists := c.items[key]
+	if !exists || item.expired(now) {
+		return cacheItem[K, V]{}, false
+	}
+	if c.sliding && item.expiration != 0 {
+		item.expiration = now + int64(item.ttl)
+		c.expiry.update(item)
+	}
+	if c.bounded() {
+		c.lruMoveToFront(item)
+	}
+	return *item, true
+}
+
+// Delete removes key from the cache. Deleting a missing key is a no-op.
+func (c *Cache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	var evicted []eviction[K, V]
+	if item, exists := c.items[key]; exists {
+		c.removeLocked(item)
+		reason := ReasonDeleted
+		if item.expired(time.Now().UnixNano()) {
+			reason = ReasonExpired
+		}
+		evicted = c.evictedLocked(evicted, item, reason)
+	}
+	onEvicted := c.onEvicted
+	c.mu.Unlock()
+
+	notify(onEvicted, evicted)
+}
+
+// Len returns the number of unexpired items.
+func (c *Cache[K, V]) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := time.Now().UnixNano()
+	n := 0
+	for _, item := range c.items {
+		if !item.expired(now) {
+			n++
+		}
+	}
+	return n
+}
+
+// Keys returns the keys of all unexpired items in no particular order.
+func (c *Cache[K, V]) Keys() []K {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := time.Now().UnixNano()
+	keys := make([]K, 0, len(c.items))
+	for k, item := range c.items {
+		if !item.expired(now) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// Range calls fn for every unexpired item until fn returns false. It works on
+// a snapshot taken when Range is called, so fn may safely call back into the
+// cache; changes made meanwhile are not reflected in the iteration.
+func (c *Cache[K, V]) Range(fn func(key K, value V) bool) {
+	type entry struct {
+		key   K
+		value V
+	}
+
+	c.mu.RLock()
+	now := time.Now().UnixNano()
+	snapshot := make([]entry, 0, len(c.items))
+	for k, item := range c.items {
+		if !item.expired(now) {
+			snapshot = append(snapshot, entry{k, item.value})
+		}
+	}
+	c.mu.RUnlock()
+
+	for _, e := range snapshot {
+		if !fn(e.key, e.value) {
+			return
+		}
+	}
+}
+
+// Clear removes every item from the cache.
+func (c *Cache[K, V]) Clear() {
+	c.mu.Lock()
+	evicted := c.clearLocked()
+	onEvicted := c.onEvicted
+	c.mu.Unlock()
+
+	notify(onEvicted, evicted)
+}
+
+func (c *Cache[K, V]) clearLocked() []eviction[K, V] {
+	var evicted []eviction[K, V]
+	if c.onEvicted != nil {
+		evicted = make([]eviction[K, V], 0, len(c.items))
+	}
+	now := time.Now().UnixNano()
+	for _, item := range c.items {
+		reason := ReasonDeleted
+		if item.expired(now) {
+			reason = ReasonExpired
+		}
+		evicted = c.evictedLocked(evicted, item, reason)
+	}
+	c.items = make(map[K]*cacheItem[K, V])
+	c.expiry = nil
+	c.lruInit()
+	c.usedCost = 0
+	c.tags = make(map[string]map[K]struct{})
+	if c.prefixes != nil {
+		c.prefixes = &keyTrie{}
+	}
+	return evicted
+}
+
+func (c *Cache[K, V]) startEviction(ctx context.Context, interval time.Duration) {
+	defer close(c.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if c.autoSave != "" {
+				c.persist()
+			}
+			c.mu.Lock()
+			c.closed = true
+			evicted := c.clearLocked()
+			onEvicted := c.onEvicted
+			c.mu.Unlock()
+
+			notify(onEvicted, evicted)
+			c.waitRefreshes()
+			return
+		case <-ticker.C:
+		}
+
+		// Yield between batches so waiting readers and writers get the
+		// lock before the next batch.
+		for c.evictExpired(janitorBatch) == janitorBatch {
+			runtime.Gosched()
+		}
+		c.pruneNegatives()
+	}
+}
+
+// evictExpired removes up to max expired items from the top of the expiry
+// heap and reports how many it removed. The work is proportional to the
+// number of expired items, not the size of the cache.
+func (c *Cache[K, V]) evictExpired(max int) int {
+	c.mu.Lock()
+	now := time.Now().UnixNano()
+	var evicted []eviction[K, V]
+	n := 0
+	for ; n < max; n++ {
+		item := c.expiry.peek()
+		if item == nil || !item.expired(now) {
+			break
+		}
+		c.removeLocked(item)
+		evicted = c.evictedLocked(evicted, item, ReasonExpired)
+	}
+	onEvicted := c.onEvicted
+	c.mu.Unlock()
+
+	notify(onEvicted, evicted)
+	return n
+}
+
+// Review Points:
+// Concurrency: Uses sync.RWMutex to ensure safe concurrent access.
+// Expiration Strategy: Implements a background goroutine to periodically evict expired items.
+// Scalability: A min-heap keyed on expiration lets the janitor pop only the expired items, in small batches, instead of locking and scanning the whole map on every tick.
+// Per-item TTLs: SetWithTTL gives each item its own lifetime; sliding expiration trades the shared read lock in Get for keeping hot items alive.
+// Callbacks: OnEvicted is told about every item that leaves the cache; evictions are collected under the lock and reported after it is released, so callbacks cannot deadlock the cache.
+// Loading: GetOrLoad coalesces concurrent misses for a key into a single load (singleflight), so a cold key does not stampede the backing store.
+// Refresh-ahead: With a soft TTL, hot keys are refreshed in the background while the stale value keeps being served, instead of all missing at once when the TTL passes.
+// Observability: Stats exposes lock-free hit, miss, eviction and load counters, which can be scraped through PrometheusHandler.
+// Capacity: WithMaxCost bounds the cache by a per-item cost (entries or bytes) with LRU eviction; the optional TinyLFU filter keeps one-hit wonders from flushing hot entries. Bounded caches lock exclusively in Get to maintain the LRU order.
+// Invalidation: Tags and an optional key trie are secondary indexes, so InvalidateTag and InvalidatePrefix cost O(matches) instead of a scan of every item.
+// Persistence: Save and Load snapshot items with their absolute expirations through a pluggable Codec, so a restarted service does not start cold; WithAutoSave does it on Close and New.
+// Lifecycle: The janitor goroutine and its ticker are released by Close (or by cancelling the context passed to NewWithContext), so caches do not leak goroutines.
+// Generics: Cache[K, V] is type-safe, so callers never need a type assertion on Get.
+// Design Trade-offs: Candidate can discuss alternative eviction strategies (e.g., LRU) and improvements like using third-party caching libraries.
@@ -0,0 +1,320 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newCache(t *testing.T, ttl time.Duration, opts ...Option) *Cache[string, int] {
+	t.Helper()
+	c := New[string, int](ttl, opts...)
+	t.Cleanup(c.Close)
+	return c
+}
+
+func TestGetSetDelete(t *testing.T) {
+	c := newCache(t, time.Minute)
+
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("Get of a missing key reported a hit")
+	}
+	c.Set("a", 1)
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("Get = %d, %v; want 1, true", v, ok)
+	}
+	c.Set("a", 2)
+	if v, _ := c.Get("a"); v != 2 {
+		t.Fatalf("Get after a second Set = %d, want 2", v)
+	}
+
+	c.Delete("a")
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("Get after Delete reported a hit")
+	}
+	c.Delete("a") // deleting a missing key is a no-op
+}
+
+func TestExpiration(t *testing.T) {
+	c := newCache(t, 50*time.Millisecond)
+	c.Set("short", 1)
+	c.SetWithTTL("forever", 2, NoExpiration)
+
+	if _, d, _ := c.GetWithExpiration("forever"); d != NoExpiration {
+		t.Errorf("remaining lifetime of a non-expiring item = %v, want NoExpiration", d)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := c.Get("short"); ok {
+		t.Error("Get returned an expired item")
+	}
+	if _, ok := c.Get("forever"); !ok {
+		t.Error("an item set with NoExpiration expired")
+	}
+	if n := c.Len(); n != 1 {
+		t.Errorf("Len = %d, want 1 without the expired item", n)
+	}
+}
+
+func TestSlidingExpiration(t *testing.T) {
+	const ttl = 50 * time.Millisecond
+	c := newCache(t, ttl, WithSlidingExpiration())
+	c.Set("read", 1)
+	c.Set("idle", 2)
+
+	// Reading every 20ms keeps the item alive well past its TTL.
+	for i := 0; i < 6; i++ {
+		time.Sleep(20 * time.Millisecond)
+		_, left, ok := c.GetWithExpiration("read")
+		if !ok {
+			t.Fatalf("read item expired after %d reads", i)
+		}
+		if left != ttl {
+			t.Errorf("remaining lifetime after a read = %v, want the full %v", left, ttl)
+		}
+	}
+	if _, ok := c.Get("idle"); ok {
+		t.Error("an item nobody read outlived its TTL")
+	}
+
+	time.Sleep(ttl + 10*time.Millisecond)
+	if _, ok := c.Get("read"); ok {
+		t.Error("the read item did not expire once reads stopped")
+	}
+}
+
+func TestGetWithExpiration(t *testing.T) {
+	c := newCache(t, time.Minute)
+	c.SetWithTTL("k", 1, 100*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+
+	v, left, ok := c.GetWithExpiration("k")
+	if !ok || v != 1 {
+		t.Fatalf("GetWithExpiration = %d, %v; want 1, true", v, ok)
+	}
+	if left <= 0 || left > 80*time.Millisecond {
+		t.Errorf("remaining lifetime = %v, want at most 80ms", left)
+	}
+	if _, left, _ := c.GetWithExpiration("k"); left > 80*time.Millisecond {
+		t.Errorf("a read without sliding expiration extended the item to %v", left)
+	}
+}
+
+func TestLenKeysRange(t *testing.T) {
+	c := newCache(t, time.Minute)
+	want := map[string]int{"a": 1, "b": 2, "c": 3}
+	for k, v := range want {
+		c.Set(k, v)
+	}
+
+	if n := c.Len(); n != len(want) {
+		t.Errorf("Len = %d, want %d", n, len(want))
+	}
+
+	keys := c.Keys()
+	sort.Strings(keys)
+	if fmt.Sprint(keys) != "[a b c]" {
+		t.Errorf("Keys = %v, want [a b c]", keys)
+	}
+
+	got := make(map[string]int)
+	c.Range(func(k string, v int) bool {
+		got[k] = v
+		return true
+	})
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Range visited %v, want %v", got, want)
+	}
+
+	calls := 0
+	c.Range(func(string, int) bool {
+		calls++
+		return false
+	})
+	if calls != 1 {
+		t.Errorf("Range called fn %d times after it returned false, want 1", calls)
+	}
+
+	// fn may call back into the cache.
+	c.Range(func(k string, _ int) bool {
+		c.Delete(k)
+		return true
+	})
+	if n := c.Len(); n != 0 {
+		t.Errorf("Len after deleting every key from Range = %d, want 0", n)
+	}
+}
+
+func TestClear(t *testing.T) {
+	var evicted []string
+	var mu sync.Mutex
+	c := newCache(t, time.Minute)
+	c.OnEvicted(func(k string, _ int, reason EvictionReason) {
+		mu.Lock()
+		defer mu.Unlock()
+		if reason == ReasonDeleted {
+			evicted = append(evicted, k)
+		}
+	})
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	c.Clear()
+	if n := c.Len(); n != 0 {
+		t.Errorf("Len after Clear = %d, want 0", n)
+	}
+	if _, ok := c.Get("a"); ok {
+		t.Error("Get after Clear reported a hit")
+	}
+	mu.Lock()
+	sort.Strings(evicted)
+	if fmt.Sprint(evicted) != "[a b]" {
+		t.Errorf("OnEvicted saw %v deleted, want [a b]", evicted)
+	}
+	mu.Unlock()
+
+	c.Set("a", 3)
+	if v, _ := c.Get("a"); v != 3 {
+		t.Errorf("Get after Clear and Set = %d, want 3", v)
+	}
+}
+
+// TestConcurrentAccess is meant for go test -race: every operation runs
+// from several goroutines at once, alongside an eager janitor.
+func TestConcurrentAccess(t *testing.T) {
+	c := newCache(t, 5*time.Millisecond, WithCleanupInterval(time.Millisecond))
+	const goroutines, ops = 8, 2000
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < ops; i++ {
+				key := fmt.Sprint(i % 64)
+				switch i % 8 {
+				case 0:
+					c.Delete(key)
+				case 1:
+					c.Len()
+				case 2:
+					c.Keys()
+				case 3:
+					c.Range(func(string, int) bool { return true })
+				case 4:
+					if i%400 == 4 {
+						c.Clear()
+					}
+				case 5, 6:
+					c.Set(key, i)
+				default:
+					if v, ok := c.Get(key); ok && v%64 != i%64 {
+						t.Errorf("Get(%q) = %d, a value set under another key", key, v)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// TestCloseReleasesJanitor checks that neither Close nor cancelling the
+// context leaks the janitor goroutine, which stops its ticker on the way
+// out, and that Close can be called twice.
+func TestCloseReleasesJanitor(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	caches := make([]*Cache[string, int], 0, 100)
+	for i := 0; i < 50; i++ {
+		caches = append(caches, New[string, int](time.Minute, WithCleanupInterval(time.Millisecond)))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	for i := 0; i < 50; i++ {
+		caches = append(caches, NewWithContext[string, int](ctx, time.Minute))
+	}
+	if n := runtime.NumGoroutine(); n < before+100 {
+		t.Fatalf("%d goroutines with 100 caches open, want at least %d", n, before+100)
+	}
+
+	for _, c := range caches[:50] {
+		c.Set("a", 1)
+		c.Close()
+		c.Close()
+	}
+	cancel()
+	for _, c := range caches[50:] {
+		select {
+		case <-c.done:
+		case <-time.After(time.Second):
+			t.Fatal("cancelling the context did not stop the janitor")
+		}
+	}
+
+	// Exited goroutines can take a moment to be accounted for.
+	for start := time.Now(); runtime.NumGoroutine() > before; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("%d goroutines after closing every cache, want %d", runtime.NumGoroutine(), before)
+		}
+	}
+
+	c := caches[0]
+	c.Set("a", 1)
+	if _, ok := c.Get("a"); ok {
+		t.Error("Get on a closed cache reported a hit")
+	}
+}
+
+// scanExpired is the janitor pass the expiry heap replaced: it holds the
+// lock while it looks at every item.
+func (c *Cache[K, V]) scanExpired() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now().UnixNano()
+	n := 0
+	for _, item := range c.items {
+		if item.expired(now) {
+			c.removeLocked(item)
+			n++
+		}
+	}
+	return n
+}
+
+// BenchmarkEvictExpired measures how long one janitor pass holds the lock
+// when janitorBatch of the cache's items have expired, for the expiry heap
+// and for the full-map scan it replaced. The heap's cost follows the number
+// of expired items; the scan's follows the size of the cache.
+func BenchmarkEvictExpired(b *testing.B) {
+	passes := []struct {
+		name string
+		pass func(*Cache[int, int]) int
+	}{
+		{"heap", func(c *Cache[int, int]) int { return c.evictExpired(janitorBatch) }},
+		{"scan", (*Cache[int, int]).scanExpired},
+	}
+	for _, size := range []int{100_000, 1_000_000, 4_000_000} {
+		c := New[int, int](time.Hour, WithCleanupInterval(time.Hour))
+		for i := 0; i < size; i++ {
+			c.Set(i, i)
+		}
+		for _, p := range passes {
+			b.Run(fmt.Sprintf("%s/items=%d", p.name, size), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					for k := size; k < size+janitorBatch; k++ {
+						c.SetWithTTL(k, k, time.Nanosecond)
+					}
+					time.Sleep(time.Microsecond)
+					b.StartTimer()
+					if n := p.pass(c); n != janitorBatch {
+						b.Fatalf("removed %d expired items, want %d", n, janitorBatch)
+					}
+				}
+			})
+		}
+		c.Close()
+	}
+}
@@ -0,0 +1,212 @@
+package cache
+
+import (
+	"fmt"
+	"hash/maphash"
+)
+
+// A bounded cache (WithMaxCost) keeps its items in a doubly linked list in
+// least-recently-used order, threaded through the items themselves with
+// c.lru as the sentinel: c.lru.next is the most and c.lru.prev the least
+// recently used item. When an item does not fit, items are evicted from the
+// back of the list.
+//
+// With WithTinyLFU a new key must also be used at least as often as the
+// items it would evict. Access frequencies are estimated with a count-min
+// sketch, so keys that are seen once ("one-hit wonders") cannot flush out
+// the hot set the way they do in a plain LRU.
+
+func (c *Cache[K, V]) bounded() bool {
+	return c.maxCost > 0
+}
+
+func (c *Cache[K, V]) lruInit() {
+	c.lru.next = &c.lru
+	c.lru.prev = &c.lru
+}
+
+func (c *Cache[K, V]) lruPushFront(item *cacheItem[K, V]) {
+	item.prev = &c.lru
+	item.next = c.lru.next
+	item.prev.next = item
+	item.next.prev = item
+}
+
+func (c *Cache[K, V]) lruRemove(item *cacheItem[K, V]) {
+	if item.prev == nil {
+		return
+	}
+	item.prev.next = item.next
+	item.next.prev = item.prev
+	item.prev, item.next = nil, nil
+}
+
+func (c *Cache[K, V]) lruMoveToFront(item *cacheItem[K, V]) {
+	c.lruRemove(item)
+	c.lruPushFront(item)
+}
+
+func (c *Cache[K, V]) costOf(key K, value V) int64 {
+	if c.cost == nil {
+		return 1
+	}
+	return c.cost(key, value)
+}
+
+// makeRoomLocked evicts least recently used items until an item of cost
+// fits next to the others. current is the item already stored under key, or
+// nil for a new key; it is never evicted to make room for itself. It
+// reports false, evicting nothing, if the admission filter prefers the
+// items that would have to go.
+func (c *Cache[K, V]) makeRoomLocked(key K, current *cacheItem[K, V], cost int64, evicted []eviction[K, V]) ([]eviction[K, V], bool) {
+	over := c.usedCost + cost - c.maxCost
+	if current != nil {
+		over -= current.cost
+	}
+	if over <= 0 {
+		return evicted, true
+	}
+
+	var victims []*cacheItem[K, V]
+	var freed int64
+	for v := c.lru.prev; v != &c.lru && freed < over; v = v.prev {
+		if v == current {
+			continue
+		}
+		victims = append(victims, v)
+		freed += v.cost
+	}
+
+	if c.sketch != nil && current == nil {
+		freq := c.sketch.estimate(hashKey(key))
+		for _, v := range victims {
+			if c.sketch.estimate(hashKey(v.key)) > freq {
+				return evicted, false
+			}
+		}
+	}
+
+	for _, v := range victims {
+		c.removeLocked(v)
+		evicted = c.evictedLocked(evicted, v, ReasonCapacity)
+	}
+	return evicted, true
+}
+
+// countMinSketch estimates how often keys have been seen in a small, fixed
+// amount of memory. Each key increments one saturating 4-bit counter in each
+// of four rows and its estimate is the smallest of them; collisions can only
+// make an estimate too high. Once the number of increments reaches ten
+// times the width, every counter is halved so that old popularity fades.
+type countMinSketch struct {
+	rows      [4][]uint8
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+const sketchMax = 15
+
+func newCountMinSketch(expectedItems int) *countMinSketch {
+	width := 64
+	for width < expectedItems {
+		width *= 2
+	}
+	s := &countMinSketch{mask: uint64(width - 1), resetAt: 10 * width}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *countMinSketch) index(h uint64, row int) uint64 {
+	return mix64(h+uint64(row)*0x9e3779b97f4a7c15) & s.mask
+}
+
+func (s *countMinSketch) increment(h uint64) {
+	for i := range s.rows {
+		if idx := s.index(h, i); s.rows[i][idx] < sketchMax {
+			s.rows[i][idx]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.resetAt {
+		for i := range s.rows {
+			for j := range s.rows[i] {
+				s.rows[i][j] /= 2
+			}
+		}
+		s.additions /= 2
+	}
+}
+
+func (s *countMinSketch) estimate(h uint64) uint8 {
+	min := uint8(sketchMax)
+	for i := range s.rows {
+		if v := s.rows[i][s.index(h, i)]; v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+var hashSeed = maphash.MakeSeed()
+
+// hashKey hashes the common key types directly and everything else through
+// its fmt representation.
+func hashKey[K comparable](key K) uint64 {
+	switch k := any(key).(type) {
+	case string:
+		return maphash.String(hashSeed, k)
+	case int:
+		return mix64(uint64(k))
+	case int32:
+		return mix64(uint64(k))
+	case int64:
+		return mix64(uint64(k))
+	case uint:
+		return mix64(uint64(k))
+	case uint32:
+		return mix64(uint64(k))
+	case uint64:
+		return mix64(k)
+	default:
+		return maphash.String(hashSeed, fmt.Sprint(k))
+	}
+}
+
+// mix64 is the splitmix64 finalizer.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// SetCostFunc sets the function that computes an item's cost for
+// WithMaxCost, for example the size of the value in bytes; pass nil for the
+// default cost of 1. The items already stored are costed again, and the
+// least recently used ones evicted until the rest fit.
+func (c *Cache[K, V]) SetCostFunc(cost func(key K, value V) int64) {
+	c.mu.Lock()
+	c.cost = cost
+	var evicted []eviction[K, V]
+	if c.bounded() {
+		c.usedCost = 0
+		for item := c.lru.next; item != &c.lru; item = item.next {
+			item.cost = c.costOf(item.key, item.value)
+			c.usedCost += item.cost
+		}
+		for c.usedCost > c.maxCost {
+			victim := c.lru.prev
+			c.removeLocked(victim)
+			evicted = c.evictedLocked(evicted, victim, ReasonCapacity)
+		}
+	}
+	onEvicted := c.onEvicted
+	c.mu.Unlock()
+
+	notify(onEvicted, evicted)
+}
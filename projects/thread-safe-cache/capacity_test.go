@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+func sortedKeys(c *Cache[string, int]) string {
+	keys := c.Keys()
+	sort.Strings(keys)
+	return fmt.Sprint(keys)
+}
+
+func TestLRUEviction(t *testing.T) {
+	c := newCache(t, time.Minute, WithMaxCost(3))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Get("a") // b is now the least recently used
+	c.Set("d", 4)
+
+	if got := sortedKeys(c); got != "[a c d]" {
+		t.Errorf("keys = %s, want [a c d] with the least recently used b evicted", got)
+	}
+	c.Set("a", 5) // replacing an item needs no room
+	if got := sortedKeys(c); got != "[a c d]" {
+		t.Errorf("keys after replacing a = %s, want [a c d]", got)
+	}
+}
+
+func TestCostFunc(t *testing.T) {
+	c := newCache(t, time.Minute, WithMaxCost(10))
+	c.SetCostFunc(func(_ string, size int) int64 { return int64(size) })
+	c.Set("a", 4)
+	c.Set("b", 4)
+	c.Set("c", 4) // 12 > 10: a must go
+
+	if got := sortedKeys(c); got != "[b c]" {
+		t.Errorf("keys = %s, want [b c]", got)
+	}
+
+	// Costing the items again evicts until they fit.
+	c.SetCostFunc(func(_ string, size int) int64 { return int64(2 * size) })
+	if got := sortedKeys(c); got != "[c]" {
+		t.Errorf("keys after doubling every cost = %s, want [c]", got)
+	}
+}
+
+func TestOversizedItemRejected(t *testing.T) {
+	c := newCache(t, time.Minute, WithMaxCost(10))
+	c.SetCostFunc(func(_ string, size int) int64 { return int64(size) })
+	c.Set("k", 3)
+	c.Set("other", 3)
+
+	c.Set("k", 11)
+	if v, ok := c.Get("k"); ok {
+		t.Errorf("Get = %d after storing an item costing more than the maximum, want a miss", v)
+	}
+	if _, ok := c.Get("other"); !ok {
+		t.Error("a rejected item evicted another one")
+	}
+	if n := c.Stats().Rejections; n != 1 {
+		t.Errorf("Rejections = %d, want 1", n)
+	}
+}
+
+func TestTinyLFUAdmission(t *testing.T) {
+	c := newCache(t, time.Minute, WithMaxCost(2), WithTinyLFU(100))
+	c.Set("hot1", 1)
+	c.Set("hot2", 2)
+	for i := 0; i < 10; i++ {
+		c.Get("hot1")
+		c.Get("hot2")
+	}
+
+	c.Set("once", 3)
+	if _, ok := c.Get("once"); ok {
+		t.Error("a key seen once displaced a hot key")
+	}
+	if got := sortedKeys(c); got != "[hot1 hot2]" {
+		t.Errorf("keys = %s, want the hot keys", got)
+	}
+
+	// A key that becomes popular is admitted.
+	for i := 0; i < 20; i++ {
+		c.Get("rising")
+	}
+	c.Set("rising", 4)
+	if _, ok := c.Get("rising"); !ok {
+		t.Error("a key used more often than the items it evicts was turned away")
+	}
+}
+
+// BenchmarkHitRatio replays a Zipf-distributed key stream against a cache
+// bounded to 1000 entries, with and without TinyLFU admission, and reports
+// the hit ratio. On such a skewed workload TinyLFU keeps the popular keys
+// that a plain LRU keeps losing to keys requested only once. The ratio
+// depends on the number of requests, so compare runs with a fixed count:
+//
+//	go test -bench HitRatio -benchtime 200000x
+func BenchmarkHitRatio(b *testing.B) {
+	for _, bench := range []struct {
+		name string
+		opts []Option
+	}{
+		{"lru", []Option{WithMaxCost(1000)}},
+		{"tinylfu", []Option{WithMaxCost(1000), WithTinyLFU(1000)}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			c := New[uint64, int](NoExpiration, bench.opts...)
+			defer c.Close()
+			zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.1, 1, 1_000_000)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				key := zipf.Uint64()
+				if _, found := c.Get(key); !found {
+					c.Set(key, i)
+				}
+			}
+			b.ReportMetric(c.Stats().HitRatio(), "hit-ratio")
+		})
+	}
+}
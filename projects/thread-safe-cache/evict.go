@@ -0,0 +1,68 @@
+package cache
+
+// EvictionReason tells an OnEvicted callback why an item left the cache.
+type EvictionReason int
+
+const (
+	// ReasonExpired: the item's TTL passed.
+	ReasonExpired EvictionReason = iota
+	// ReasonDeleted: the item was removed by Delete, Clear or Close.
+	ReasonDeleted
+	// ReasonReplaced: Set stored a new value under the item's key.
+	ReasonReplaced
+	// ReasonCapacity: the item was evicted to keep the cache within its
+	// capacity.
+	ReasonCapacity
+)
+
+func (r EvictionReason) String() string {
+	switch r {
+	case ReasonExpired:
+		return "expired"
+	case ReasonDeleted:
+		return "deleted"
+	case ReasonReplaced:
+		return "replaced"
+	case ReasonCapacity:
+		return "capacity"
+	default:
+		return "unknown"
+	}
+}
+
+// eviction is an item that left the cache while the lock was held, waiting
+// to be reported once it is released.
+type eviction[K comparable, V any] struct {
+	key    K
+	value  V
+	reason EvictionReason
+}
+
+// OnEvicted registers fn to be called whenever an item leaves the cache,
+// replacing any previous callback; pass nil to remove it. Use it to release
+// resources held by cached values or to emit metrics.
+//
+// fn is called after the cache lock has been released, so it may call back
+// into the cache. It can be called from several goroutines at once.
+func (c *Cache[K, V]) OnEvicted(fn func(key K, value V, reason EvictionReason)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onEvicted = fn
+}
+
+// evictedLocked records that item left the cache. It must be called with
+// c.mu held; the returned slice is passed to notify after unlocking.
+func (c *Cache[K, V]) evictedLocked(evicted []eviction[K, V], item *cacheItem[K, V], reason EvictionReason) []eviction[K, V] {
+	c.stats.recordEviction(reason)
+	if c.onEvicted == nil {
+		return evicted
+	}
+	return append(evicted, eviction[K, V]{key: item.key, value: item.value, reason: reason})
+}
+
+// notify reports evictions to fn, which the caller read under the lock.
+func notify[K comparable, V any](fn func(K, V, EvictionReason), evicted []eviction[K, V]) {
+	for _, e := range evicted {
+		fn(e.key, e.value, e.reason)
+	}
+}
@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// evictionLog records what an OnEvicted callback saw.
+type evictionLog struct {
+	mu      sync.Mutex
+	reasons map[string]EvictionReason
+}
+
+func watchEvictions(c *Cache[string, int]) *evictionLog {
+	l := &evictionLog{reasons: make(map[string]EvictionReason)}
+	c.OnEvicted(func(key string, _ int, reason EvictionReason) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.reasons[key] = reason
+	})
+	return l
+}
+
+func (l *evictionLog) reason(key string) (EvictionReason, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	reason, ok := l.reasons[key]
+	return reason, ok
+}
+
+func TestEvictionReasons(t *testing.T) {
+	c := newCache(t, time.Minute, WithMaxCost(3), WithCleanupInterval(5*time.Millisecond))
+	log := watchEvictions(c)
+
+	c.SetWithTTL("expired", 1, time.Millisecond)
+	c.Set("replaced", 1)
+	c.Set("replaced", 2)
+	c.Set("deleted", 1)
+	c.Delete("deleted")
+	for start := time.Now(); ; time.Sleep(time.Millisecond) {
+		if _, ok := log.reason("expired"); ok {
+			break
+		}
+		if time.Since(start) > time.Second {
+			t.Fatal("the janitor did not remove the expired item")
+		}
+	}
+	c.Set("a", 1)
+	c.Set("b", 1)
+	c.Set("c", 1) // evicts the least recently used "replaced"
+
+	for key, want := range map[string]EvictionReason{
+		"expired":  ReasonExpired,
+		"deleted":  ReasonDeleted,
+		"replaced": ReasonCapacity,
+	} {
+		if got, ok := log.reason(key); !ok || got != want {
+			t.Errorf("%s: reason %v (reported %v), want %v", key, got, ok, want)
+		}
+	}
+
+	c.Set("a", 2)
+	if got, _ := log.reason("a"); got != ReasonReplaced {
+		t.Errorf("a: reason %v, want %v", got, ReasonReplaced)
+	}
+}
+
+// TestEvictionCallbackCanUseCache checks that OnEvicted runs after the lock
+// is released: a callback that calls back into the cache would otherwise
+// deadlock.
+func TestEvictionCallbackCanUseCache(t *testing.T) {
+	c := newCache(t, time.Minute)
+	c.OnEvicted(func(key string, value int, reason EvictionReason) {
+		if reason == ReasonDeleted && key != "moved" {
+			c.Set("moved", value)
+			c.Len()
+		}
+	})
+	c.Set("k", 7)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Delete("k")
+		c.Set("k", 8)
+		c.Clear()
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("a callback that calls back into the cache deadlocked it")
+	}
+	if v, ok := c.Get("moved"); !ok || v != 8 {
+		t.Errorf("Get(moved) = %d, %v; want the value the callback stored after Clear", v, ok)
+	}
+}
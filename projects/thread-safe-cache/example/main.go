@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cache "go-cookbook/projects/thread-safe-cache"
+)
+
+func main() {
+	before := runtime.NumGoroutine()
+	c := cache.New[string, string](2 * time.Second)
+	c.OnEvicted(func(key, value string, reason cache.EvictionReason) {
+		fmt.Printf("  evicted %s = %s (%s)\n", key, value, reason)
+	})
+	c.Set("foo", "bar")
+	if value, found := c.Get("foo"); found {
+		fmt.Println("Found:", value)
+	} else {
+		fmt.Println("Not Found")
+	}
+
+	c.Set("baz", "qux")
+	c.Set("baz", "quux")
+	fmt.Println("Len:", c.Len())
+	c.Range(func(key, value string) bool {
+		fmt.Printf("  %s = %s\n", key, value)
+		return true
+	})
+
+	time.Sleep(3 * time.Second)
+	if value, found := c.Get("foo"); found {
+		fmt.Println("Found:", value)
+	} else {
+		fmt.Println("Not Found after expiration")
+	}
+
+	// Per-item TTLs and sliding expiration: a session that is read keeps
+	// living, one that is left alone expires.
+	sessions := cache.New[string, int](time.Second, cache.WithSlidingExpiration())
+	sessions.SetWithTTL("active", 1, 500*time.Millisecond)
+	sessions.SetWithTTL("idle", 2, 500*time.Millisecond)
+	sessions.SetWithTTL("admin", 3, cache.NoExpiration)
+	for i := 0; i < 4; i++ {
+		time.Sleep(200 * time.Millisecond)
+		sessions.Get("active")
+	}
+	_, left, activeFound := sessions.GetWithExpiration("active")
+	_, idleFound := sessions.Get("idle")
+	_, adminLeft, _ := sessions.GetWithExpiration("admin")
+	fmt.Printf("active: %v (%v left), idle: %v, admin never expires: %v\n",
+		activeFound, left.Round(time.Millisecond), idleFound, adminLeft == cache.NoExpiration)
+	sessions.Close()
+
+	// GetOrLoad: ten concurrent misses for the same key share one load, and
+	// a failed load is remembered for a while with negative caching.
+	users := cache.New[int, string](time.Minute, cache.WithNegativeCaching(time.Second))
+	var loads int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			users.GetOrLoad(context.Background(), 42, func(ctx context.Context) (string, error) {
+				atomic.AddInt32(&loads, 1)
+				time.Sleep(100 * time.Millisecond) // simulate a database query
+				return "user-42", nil
+			})
+		}()
+	}
+	wg.Wait()
+	name, _ := users.Get(42)
+	fmt.Printf("Loaded %s with %d load(s)\n", name, atomic.LoadInt32(&loads))
+
+	errNotFound := errors.New("user not found")
+	for i := 0; i < 3; i++ {
+		_, err := users.GetOrLoad(context.Background(), 7, func(ctx context.Context) (string, error) {
+			atomic.AddInt32(&loads, 1)
+			return "", errNotFound
+		})
+		fmt.Println("Load user 7:", err)
+	}
+	fmt.Println("Total loads:", atomic.LoadInt32(&loads))
+	stats := users.Stats()
+	fmt.Printf("Stats: %d hits, %d misses, hit ratio %.2f, %d loads ok, %d failed\n",
+		stats.Hits, stats.Misses, stats.HitRatio(), stats.LoadSuccesses, stats.LoadFailures)
+	users.Close()
+
+	// Stale-while-revalidate: after the soft TTL the old price is still
+	// served while a fresh one is loaded in the background.
+	var version int32
+	prices := cache.New[string, string](time.Second, cache.WithSoftTTL(200*time.Millisecond))
+	prices.SetLoader(func(ctx context.Context, key string) (string, error) {
+		return fmt.Sprintf("%s-v%d", key, atomic.AddInt32(&version, 1)), nil
+	})
+	prices.Set("btc", "btc-v0")
+	time.Sleep(300 * time.Millisecond)
+	stale, _ := prices.Get("btc")
+	time.Sleep(50 * time.Millisecond)
+	fresh, _ := prices.Get("btc")
+	fmt.Println("Stale:", stale, "then refreshed:", fresh)
+	prices.Close()
+
+	// Capacity: a cache bounded to 1 KiB of values evicts the least recently
+	// used entries to make room.
+	pages := cache.New[string, []byte](cache.NoExpiration, cache.WithMaxCost(1024))
+	pages.SetCostFunc(func(key string, value []byte) int64 { return int64(len(value)) })
+	pages.OnEvicted(func(key string, value []byte, reason cache.EvictionReason) {
+		fmt.Printf("  evicted %s (%d bytes, %s)\n", key, len(value), reason)
+	})
+	pages.Set("/", make([]byte, 400))
+	pages.Set("/about", make([]byte, 400))
+	pages.Get("/")
+	pages.Set("/blog", make([]byte, 400))
+	fmt.Println("Pages:", pages.Keys())
+	pages.Close()
+
+	// Snapshots: Save and Load carry the items and their deadlines across a
+	// restart; items that expired in between are dropped.
+	warm := cache.New[string, int](time.Minute, cache.WithCodec(cache.JSONCodec))
+	warm.Set("answer", 42)
+	warm.SetWithTTL("short", 1, 100*time.Millisecond)
+	var snapshot bytes.Buffer
+	if err := warm.Save(&snapshot); err != nil {
+		fmt.Println("Save:", err)
+	}
+	warm.Close()
+	time.Sleep(150 * time.Millisecond)
+	restored := cache.New[string, int](time.Minute, cache.WithCodec(cache.JSONCodec))
+	if err := restored.Load(&snapshot); err != nil {
+		fmt.Println("Load:", err)
+	}
+	fmt.Println("Restored keys:", restored.Keys())
+	restored.Close()
+
+	// WithAutoSave does the same through a file on Close and New.
+	path := filepath.Join(os.TempDir(), "cache-example.gob")
+	logErr := func(err error) { fmt.Println("Auto-save:", err) }
+	first := cache.New[string, int](time.Minute, cache.WithAutoSave(path, logErr))
+	first.Set("visits", 7)
+	first.Close()
+	second := cache.New[string, int](time.Minute, cache.WithAutoSave(path, logErr))
+	visits, _ := second.Get("visits")
+	fmt.Println("Visits after restart:", visits)
+	second.Close()
+	os.Remove(path)
+
+	// Tags and prefixes drop a whole group of entries at once, here every
+	// entry of tenant 1.
+	tenants := cache.New[string, string](time.Minute, cache.WithPrefixIndex())
+	tenants.SetWithTags("tenant:1:user:1", "alice", cache.DefaultExpiration, "tenant:1", "users")
+	tenants.SetWithTags("tenant:1:user:2", "bob", cache.DefaultExpiration, "tenant:1", "users")
+	tenants.SetWithTags("tenant:2:user:1", "carol", cache.DefaultExpiration, "tenant:2", "users")
+	tenants.Set("tenant:1:plan", "pro")
+	fmt.Printf("Invalidated tag %q: %d\n", "tenant:1", tenants.InvalidateTag("tenant:1"))
+	fmt.Printf("Invalidated prefix %q: %d\n", "tenant:1:", tenants.InvalidatePrefix("tenant:1:"))
+	fmt.Println("Left:", tenants.Keys(), "tagged", tenants.Tags("tenant:2:user:1"))
+	tenants.Close()
+
+	// Close stops the janitor goroutine; calling it twice is fine.
+	c.Close()
+	c.Close()
+	c.Set("foo", "bar")
+	_, found := c.Get("foo")
+	fmt.Println("Found after Close:", found)
+	fmt.Println("Goroutines leaked:", runtime.NumGoroutine()-before)
+}
@@ -0,0 +1,66 @@
+package cache
+
+import "container/heap"
+
+// expiryHeap is a min-heap of the expiring items ordered by deadline, so the
+// janitor finds expired items by looking at the top instead of scanning the
+// whole map. Items that never expire are not in the heap. Each item records
+// its position in heapIndex so it can be fixed up or removed in O(log n)
+// when it is updated or deleted.
+type expiryHeap[K comparable, V any] []*cacheItem[K, V]
+
+func (h expiryHeap[K, V]) Len() int { return len(h) }
+
+func (h expiryHeap[K, V]) Less(i, j int) bool {
+	return h[i].expiration < h[j].expiration
+}
+
+func (h expiryHeap[K, V]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIndex = i
+	h[j].heapIndex = j
+}
+
+func (h *expiryHeap[K, V]) Push(x any) {
+	item := x.(*cacheItem[K, V])
+	item.heapIndex = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *expiryHeap[K, V]) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	item.heapIndex = -1
+	*h = old[:n-1]
+	return item
+}
+
+// update places item correctly in the heap after its expiration changed,
+// adding or removing it as needed.
+func (h *expiryHeap[K, V]) update(item *cacheItem[K, V]) {
+	switch {
+	case item.expiration == 0 && item.heapIndex >= 0:
+		heap.Remove(h, item.heapIndex)
+	case item.expiration == 0:
+	case item.heapIndex >= 0:
+		heap.Fix(h, item.heapIndex)
+	default:
+		heap.Push(h, item)
+	}
+}
+
+func (h *expiryHeap[K, V]) remove(item *cacheItem[K, V]) {
+	if item.heapIndex >= 0 {
+		heap.Remove(h, item.heapIndex)
+	}
+}
+
+// peek returns the item that expires first, or nil.
+func (h expiryHeap[K, V]) peek() *cacheItem[K, V] {
+	if len(h) == 0 {
+		return nil
+	}
+	return h[0]
+}
@@ -0,0 +1,153 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrClosed is returned by GetOrLoad once the cache has been closed.
+var ErrClosed = errors.New("cache: closed")
+
+// loadCall is a load in flight for one key. Every GetOrLoad that misses on
+// the key while it runs waits for it instead of starting its own.
+type loadCall[V any] struct {
+	done    chan struct{}
+	value   V
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// negativeEntry remembers a failed load so it is not retried until the
+// entry expires.
+type negativeEntry struct {
+	err        error
+	expiration int64
+}
+
+// GetOrLoad returns the value stored under key, calling loader to produce
+// and store it (with the cache's default TTL) on a miss. The loaded value
+// keeps the tags of an expired value it replaces.
+//
+// Concurrent misses for the same key share a single call to loader. A caller
+// whose ctx is done stops waiting and gets ctx.Err(); the load itself is only
+// cancelled once every caller waiting for it has given up, or the cache is
+// closed. The context passed to loader carries the values of the first
+// caller's ctx.
+//
+// Load errors are returned to every waiting caller and, with
+// WithNegativeCaching, returned for the key without calling loader again
+// until the negative entry expires.
+func (c *Cache[K, V]) GetOrLoad(ctx context.Context, key K, loader func(ctx context.Context) (V, error)) (V, error) {
+	var zero V
+	if value, ok := c.Get(key); ok {
+		return value, nil
+	}
+
+	c.loadMu.Lock()
+	if c.isClosed() {
+		c.loadMu.Unlock()
+		return zero, ErrClosed
+	}
+	if neg, ok := c.negatives[key]; ok {
+		if time.Now().UnixNano() <= neg.expiration {
+			c.loadMu.Unlock()
+			return zero, neg.err
+		}
+		delete(c.negatives, key)
+	}
+	call, ok := c.loads[key]
+	if ok {
+		call.waiters++
+	} else {
+		// A load that finished since the Get above has stored the value
+		// before leaving c.loads; look again rather than load it twice.
+		if item, ok := c.lookup(key, time.Now().UnixNano()); ok {
+			c.loadMu.Unlock()
+			return item.value, nil
+		}
+		call = c.startLoad(ctx, key, loader)
+	}
+	c.loadMu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-ctx.Done():
+		c.loadMu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			// Nobody wants the result any more. Later callers must not
+			// join a load that is being cancelled, so they start their
+			// own.
+			call.cancel()
+			if c.loads[key] == call {
+				delete(c.loads, key)
+			}
+		}
+		c.loadMu.Unlock()
+		return zero, ctx.Err()
+	}
+}
+
+// startLoad runs loader in its own goroutine. It must be called with
+// c.loadMu held.
+func (c *Cache[K, V]) startLoad(ctx context.Context, key K, loader func(ctx context.Context) (V, error)) *loadCall[V] {
+	loadCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	call := &loadCall[V]{
+		done:    make(chan struct{}),
+		waiters: 1,
+		cancel:  cancel,
+	}
+	c.loads[key] = call
+
+	go func() {
+		stop := context.AfterFunc(c.ctx, cancel)
+		defer stop()
+		defer cancel()
+
+		start := time.Now()
+		value, err := loader(loadCtx)
+		c.stats.recordLoad(start, err)
+		if err == nil {
+			c.setLoaded(key, value)
+		}
+
+		c.loadMu.Lock()
+		if c.loads[key] == call {
+			delete(c.loads, key)
+		}
+		// A load that failed because nobody wanted it any more says
+		// nothing about the key, so it is not cached.
+		if err != nil && c.negativeTTL > 0 && loadCtx.Err() == nil {
+			c.negatives[key] = negativeEntry{
+				err:        err,
+				expiration: time.Now().Add(c.negativeTTL).UnixNano(),
+			}
+		}
+		call.value, call.err = value, err
+		c.loadMu.Unlock()
+		close(call.done)
+	}()
+	return call
+}
+
+// pruneNegatives drops expired negative entries; the janitor calls it on
+// every tick.
+func (c *Cache[K, V]) pruneNegatives() {
+	c.loadMu.Lock()
+	defer c.loadMu.Unlock()
+	now := time.Now().UnixNano()
+	for key, neg := range c.negatives {
+		if now > neg.expiration {
+			delete(c.negatives, key)
+		}
+	}
+}
+
+func (c *Cache[K, V]) isClosed() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.closed
+}
@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestGetOrLoadLoadsOnce checks that concurrent misses share one load. The
+// callers are spread over the load's run time, so some of them miss just as
+// it finishes and stores the value.
+func TestGetOrLoadLoadsOnce(t *testing.T) {
+	c := newCache(t, time.Minute)
+	for round := 0; round < 200; round++ {
+		key := fmt.Sprint(round)
+		var loads atomic.Int32
+		loader := func(context.Context) (int, error) {
+			loads.Add(1)
+			time.Sleep(100 * time.Microsecond)
+			return round, nil
+		}
+
+		var wg sync.WaitGroup
+		for g := 0; g < 32; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				time.Sleep(time.Duration(g) * 5 * time.Microsecond)
+				if v, err := c.GetOrLoad(context.Background(), key, loader); err != nil || v != round {
+					t.Errorf("GetOrLoad = %d, %v; want %d", v, err, round)
+				}
+			}()
+		}
+		wg.Wait()
+		if n := loads.Load(); n != 1 {
+			t.Fatalf("round %d: %d loads, want 1", round, n)
+		}
+	}
+}
+
+// TestGetOrLoadAfterLastWaiterGaveUp checks that a caller arriving after
+// every waiter of a load gave up gets a load of its own instead of the
+// cancelled one's error.
+func TestGetOrLoadAfterLastWaiterGaveUp(t *testing.T) {
+	c := newCache(t, time.Minute)
+	started := make(chan struct{}, 2)
+	loader := func(ctx context.Context) (int, error) {
+		started <- struct{}{}
+		select {
+		case <-ctx.Done():
+			// Linger like a loader slow to notice, so the cancelled
+			// load is still around when the next caller arrives.
+			time.Sleep(20 * time.Millisecond)
+			return 0, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+			return 1, nil
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	if _, err := c.GetOrLoad(ctx, "k", loader); err != context.Canceled {
+		t.Fatalf("GetOrLoad with a cancelled context: %v, want context.Canceled", err)
+	}
+
+	v, err := c.GetOrLoad(context.Background(), "k", loader)
+	if err != nil || v != 1 {
+		t.Errorf("GetOrLoad after the previous caller gave up = %d, %v; want 1, nil", v, err)
+	}
+}
@@ -0,0 +1,117 @@
+package cache
+
+import "time"
+
+// Option configures a Cache at construction time.
+type Option func(*options)
+
+type options struct {
+	sliding         bool
+	cleanupInterval time.Duration
+	negativeTTL     time.Duration
+	softTTL         time.Duration
+	maxRefreshes    int
+	maxCost         int64
+	tinyLFU         int
+	codec           Codec
+	autoSave        string
+	onPersistError  func(error)
+	prefixIndex     bool
+}
+
+// WithSlidingExpiration makes every successful Get push the item's deadline
+// back by its TTL, so items only expire after TTL without being read.
+// Sliding expiration turns Get into a write, so reads take the exclusive
+// lock.
+func WithSlidingExpiration() Option {
+	return func(o *options) {
+		o.sliding = true
+	}
+}
+
+// WithCleanupInterval sets how often the janitor removes expired items.
+// It defaults to the cache's TTL, or one minute if items do not expire by
+// default. Expired items are never returned in the meantime.
+func WithCleanupInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.cleanupInterval = d
+	}
+}
+
+// WithNegativeCaching makes GetOrLoad remember a failed load for ttl and
+// return the same error for the key without calling the loader again.
+func WithNegativeCaching(ttl time.Duration) Option {
+	return func(o *options) {
+		o.negativeTTL = ttl
+	}
+}
+
+// WithSoftTTL enables stale-while-revalidate: an item becomes stale d after
+// it was set, and a Get of a stale item returns the stale value while the
+// loader registered with SetLoader fetches a fresh one in the background.
+// The item's TTL stays the hard deadline after which it is gone. A soft TTL
+// only applies to items whose TTL is longer than d.
+func WithSoftTTL(d time.Duration) Option {
+	return func(o *options) {
+		o.softTTL = d
+	}
+}
+
+// WithMaxRefreshes bounds how many background refreshes run at once. The
+// default is 4.
+func WithMaxRefreshes(n int) Option {
+	return func(o *options) {
+		o.maxRefreshes = n
+	}
+}
+
+// WithMaxCost bounds the total cost of the items in the cache. When a Set
+// would exceed it, least recently used items are evicted to make room. By
+// default every item costs 1, which makes maxCost a maximum item count; use
+// SetCostFunc to bound memory instead.
+//
+// Bounded caches update the recency order on every Get, so Get takes the
+// exclusive lock.
+func WithMaxCost(maxCost int64) Option {
+	return func(o *options) {
+		o.maxCost = maxCost
+	}
+}
+
+// WithTinyLFU adds a TinyLFU admission filter to a bounded cache: a new key
+// is only stored if it has been used (looked up or set) at least as often,
+// recently, as each item it would evict. expectedItems sizes the frequency
+// sketch and should be about the number of items the cache holds.
+func WithTinyLFU(expectedItems int) Option {
+	return func(o *options) {
+		o.tinyLFU = expectedItems
+	}
+}
+
+// WithCodec sets the codec used by Save, Load and WithAutoSave. The default
+// is GobCodec.
+func WithCodec(codec Codec) Option {
+	return func(o *options) {
+		o.codec = codec
+	}
+}
+
+// WithAutoSave restores the cache from the snapshot at path, if it exists,
+// when the cache is created, and saves it there when the cache is closed.
+// Errors reading or writing the file are passed to onError, which may be
+// nil; they never prevent the cache from being used or closed.
+func WithAutoSave(path string, onError func(error)) Option {
+	return func(o *options) {
+		o.autoSave = path
+		o.onPersistError = onError
+	}
+}
+
+// WithPrefixIndex indexes the keys in a trie so InvalidatePrefix only visits
+// the matching keys. It costs memory per key byte and only works for caches
+// with string keys; New panics for any other key type.
+func WithPrefixIndex() Option {
+	return func(o *options) {
+		o.prefixIndex = true
+	}
+}
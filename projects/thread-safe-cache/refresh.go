@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// defaultMaxRefreshes bounds the background refreshes running at once when
+// WithMaxRefreshes is not given.
+const defaultMaxRefreshes = 4
+
+// refreshAhead reloads a stale item in the background with the loader
+// registered through SetLoader. At most one refresh per key runs at a time,
+// and when WithMaxRefreshes refreshes are already running the request is
+// dropped; a later Get of the still-stale item asks again.
+//
+// The refreshed value keeps the item's TTL and tags. If the refresh fails
+// the stale value is kept until its hard deadline, and if the item is
+// deleted, invalidated or set again while the refresh runs, the refreshed
+// value is dropped.
+func (c *Cache[K, V]) refreshAhead(key K, item cacheItem[K, V]) {
+	c.loadMu.Lock()
+	loader := c.loader
+	if loader == nil || c.ctx.Err() != nil {
+		c.loadMu.Unlock()
+		return
+	}
+	if _, ok := c.refreshing[key]; ok {
+		c.loadMu.Unlock()
+		return
+	}
+	select {
+	case c.refreshSem <- struct{}{}:
+	default:
+		c.loadMu.Unlock()
+		return
+	}
+	c.refreshing[key] = struct{}{}
+	c.refreshes.Add(1)
+	c.loadMu.Unlock()
+
+	go func() {
+		defer c.refreshes.Done()
+		defer func() {
+			c.loadMu.Lock()
+			delete(c.refreshing, key)
+			c.loadMu.Unlock()
+			<-c.refreshSem
+		}()
+
+		start := time.Now()
+		value, err := loader(c.ctx, key)
+		c.stats.recordLoad(start, err)
+		if err == nil {
+			c.storeRefresh(item, value)
+		}
+	}()
+}
+
+// SetLoader registers the function used to refresh stale items in the
+// background (see WithSoftTTL), replacing any previous one; pass nil to stop
+// refreshing. Stale items are only refreshed once a loader is set.
+func (c *Cache[K, V]) SetLoader(loader func(ctx context.Context, key K) (V, error)) {
+	c.loadMu.Lock()
+	defer c.loadMu.Unlock()
+	c.loader = loader
+}
+
+// storeRefresh replaces the item a refresh started from with the refreshed
+// value, unless the item has been removed or replaced in the meantime.
+func (c *Cache[K, V]) storeRefresh(from cacheItem[K, V], value V) {
+	c.mu.Lock()
+	current, exists := c.items[from.key]
+	if c.closed || !exists || current.version != from.version {
+		c.mu.Unlock()
+		return
+	}
+	tags := current.tags
+	evicted, item := c.setLocked(from.key, value, from.ttl, time.Now(), nil)
+	if item != nil {
+		c.tagLocked(item, tags)
+	}
+	onEvicted := c.onEvicted
+	c.mu.Unlock()
+
+	notify(onEvicted, evicted)
+}
+
+// waitRefreshes waits for background refreshes after the cache was closed.
+// Holding loadMu once orders it after any refreshAhead that saw the cache
+// still open, so no refresh can start during the Wait.
+func (c *Cache[K, V]) waitRefreshes() {
+	c.loadMu.Lock()
+	c.loadMu.Unlock()
+	c.refreshes.Wait()
+}
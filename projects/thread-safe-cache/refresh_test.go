@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// refreshing returns a cache whose items go stale after 10ms and are then
+// refreshed to the value sent on the returned channel.
+func refreshing(t *testing.T) (*Cache[string, int], chan<- int) {
+	t.Helper()
+	values := make(chan int)
+	c := newCache(t, time.Minute, WithSoftTTL(10*time.Millisecond))
+	c.SetLoader(func(ctx context.Context, _ string) (int, error) {
+		select {
+		case v := <-values:
+			return v, nil
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	})
+	return c, values
+}
+
+func TestRefreshServesStaleValue(t *testing.T) {
+	c, values := refreshing(t)
+	c.Set("k", 1)
+	time.Sleep(20 * time.Millisecond)
+
+	if v, ok := c.Get("k"); !ok || v != 1 {
+		t.Fatalf("Get of a stale item = %d, %v; want the stale 1", v, ok)
+	}
+	values <- 2
+	c.refreshes.Wait()
+	if v, _ := c.Get("k"); v != 2 {
+		t.Errorf("Get after the refresh = %d, want 2", v)
+	}
+}
+
+// TestRefreshDoesNotUndoChanges checks that a refresh only replaces the
+// item it started from: changes made while it runs win.
+func TestRefreshDoesNotUndoChanges(t *testing.T) {
+	for name, change := range map[string]func(c *Cache[string, int]){
+		"Delete":        func(c *Cache[string, int]) { c.Delete("k") },
+		"InvalidateTag": func(c *Cache[string, int]) { c.InvalidateTag("tenant") },
+		"Set":           func(c *Cache[string, int]) { c.SetWithTags("k", 3, DefaultExpiration, "tenant") },
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, values := refreshing(t)
+			c.SetWithTags("k", 1, DefaultExpiration, "tenant")
+			time.Sleep(20 * time.Millisecond)
+			c.Get("k") // starts the refresh, which waits for a value
+
+			change(c)
+			want, wantOK := c.Get("k")
+			values <- 2
+			c.refreshes.Wait()
+
+			if got, ok := c.Get("k"); got != want || ok != wantOK {
+				t.Errorf("Get after the refresh = %d, %v; want %d, %v", got, ok, want, wantOK)
+			}
+			if wantOK {
+				if n := c.InvalidateTag("tenant"); n != 1 {
+					t.Errorf("InvalidateTag after the refresh = %d, want 1", n)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package cache
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Codec serializes cache snapshots. GobCodec and JSONCodec are provided;
+// any other format can be plugged in by implementing the interface, usually
+// by wrapping the format's streaming encoder and decoder.
+type Codec interface {
+	NewEncoder(w io.Writer) Encoder
+	NewDecoder(r io.Reader) Decoder
+}
+
+// Encoder writes one value to a stream.
+type Encoder interface {
+	Encode(v any) error
+}
+
+// Decoder reads one value from a stream.
+type Decoder interface {
+	Decode(v any) error
+}
+
+type gobCodec struct{}
+
+func (gobCodec) NewEncoder(w io.Writer) Encoder { return gob.NewEncoder(w) }
+func (gobCodec) NewDecoder(r io.Reader) Decoder { return gob.NewDecoder(r) }
+
+type jsonCodec struct{}
+
+func (jsonCodec) NewEncoder(w io.Writer) Encoder { return json.NewEncoder(w) }
+func (jsonCodec) NewDecoder(r io.Reader) Decoder { return json.NewDecoder(r) }
+
+var (
+	// GobCodec is compact and the default. Interface values inside keys or
+	// values must be registered with gob.Register.
+	GobCodec Codec = gobCodec{}
+	// JSONCodec is human-readable; keys and values go through encoding/json.
+	JSONCodec Codec = jsonCodec{}
+)
+
+// snapshotVersion is bumped whenever the snapshot layout changes.
+const snapshotVersion = 1
+
+// A snapshot is written as a header followed by one value per item. Items
+// is the number of values that follow, so Load can tell a truncated
+// snapshot from a complete one. Save and Load still hold every item in
+// memory at once: Save copies the items so it can encode them without the
+// lock, and Load decodes them all before storing any.
+type snapshotHeader struct {
+	Version int
+	SavedAt time.Time
+	Items   int
+}
+
+type snapshotItem[K comparable, V any] struct {
+	Key       K
+	Value     V
+	ExpiresAt int64         // UnixNano, 0 if the item never expires
+	TTL       time.Duration // the item's own TTL, for sliding expiration
+	Tags      []string
+}
+
+// Save writes every unexpired item and its expiration to w using the cache's
+// codec (see WithCodec). Expirations are stored as wall-clock times, so
+// items that expire while the snapshot sits on disk are dropped by Load.
+func (c *Cache[K, V]) Save(w io.Writer) error {
+	now := time.Now()
+	c.mu.RLock()
+	items := make([]snapshotItem[K, V], 0, len(c.items))
+	for key, item := range c.items {
+		if item.expired(now.UnixNano()) {
+			continue
+		}
+		items = append(items, snapshotItem[K, V]{
+			Key:       key,
+			Value:     item.value,
+			ExpiresAt: item.expiration,
+			TTL:       item.ttl,
+			Tags:      item.tags,
+		})
+	}
+	c.mu.RUnlock()
+
+	enc := c.codec.NewEncoder(w)
+	if err := enc.Encode(snapshotHeader{Version: snapshotVersion, SavedAt: now, Items: len(items)}); err != nil {
+		return fmt.Errorf("cache: save: %w", err)
+	}
+	for i := range items {
+		if err := enc.Encode(&items[i]); err != nil {
+			return fmt.Errorf("cache: save: %w", err)
+		}
+	}
+	return nil
+}
+
+// Load reads a snapshot written by Save and stores its items, keeping their
+// original expirations. Items that have expired since are skipped, and items
+// already in the cache are replaced. The whole snapshot is decoded before
+// anything is stored, so a corrupt snapshot leaves the cache unchanged.
+func (c *Cache[K, V]) Load(r io.Reader) error {
+	dec := c.codec.NewDecoder(r)
+	var header snapshotHeader
+	if err := dec.Decode(&header); err != nil {
+		return fmt.Errorf("cache: load: %w", err)
+	}
+	if header.Version != snapshotVersion {
+		return fmt.Errorf("cache: load: unsupported snapshot version %d", header.Version)
+	}
+	if header.Items < 0 {
+		return fmt.Errorf("cache: load: invalid item count %d", header.Items)
+	}
+	// The count is not trusted for the allocation: a corrupt header must
+	// not make Load reserve more than the snapshot actually holds.
+	var items []snapshotItem[K, V]
+	for i := 0; i < header.Items; i++ {
+		var si snapshotItem[K, V]
+		if err := dec.Decode(&si); err != nil {
+			return fmt.Errorf("cache: load: item %d: %w", i, err)
+		}
+		items = append(items, si)
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	now := time.Now()
+	var evicted []eviction[K, V]
+	for _, si := range items {
+		if si.ExpiresAt != 0 && si.ExpiresAt <= now.UnixNano() {
+			continue
+		}
+		var item *cacheItem[K, V]
+		evicted, item = c.setLocked(si.Key, si.Value, si.TTL, now, evicted)
+		if item != nil {
+			item.expiration = si.ExpiresAt
+			c.expiry.update(item)
+			c.tagLocked(item, si.Tags)
+		}
+	}
+	onEvicted := c.onEvicted
+	c.mu.Unlock()
+
+	notify(onEvicted, evicted)
+	return nil
+}
+
+// restore loads the auto-save file, if there is one.
+func (c *Cache[K, V]) restore() {
+	f, err := os.Open(c.autoSave)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err == nil {
+		err = c.Load(f)
+		f.Close()
+	}
+	c.reportPersistError(err)
+}
+
+// persist writes the auto-save file. It writes to a temporary file first and
+// renames it, so a crash mid-save never leaves a truncated snapshot behind.
+func (c *Cache[K, V]) persist() {
+	f, err := os.CreateTemp(filepath.Dir(c.autoSave), filepath.Base(c.autoSave)+".*.tmp")
+	if err != nil {
+		c.reportPersistError(err)
+		return
+	}
+	err = c.Save(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), c.autoSave)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	c.reportPersistError(err)
+}
+
+func (c *Cache[K, V]) reportPersistError(err error) {
+	if err != nil && c.onPersistError != nil {
+		c.onPersistError(err)
+	}
+}
@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveLoad(t *testing.T) {
+	for name, codec := range map[string]Codec{"gob": GobCodec, "json": JSONCodec} {
+		t.Run(name, func(t *testing.T) {
+			src := newCache(t, time.Minute, WithCodec(codec))
+			src.Set("a", 1)
+			src.SetWithTags("b", 2, NoExpiration, "even")
+			src.SetWithTTL("gone", 3, time.Millisecond)
+			var snapshot bytes.Buffer
+			time.Sleep(5 * time.Millisecond)
+			if err := src.Save(&snapshot); err != nil {
+				t.Fatal(err)
+			}
+
+			dst := newCache(t, time.Minute, WithCodec(codec))
+			if err := dst.Load(&snapshot); err != nil {
+				t.Fatal(err)
+			}
+			if v, _ := dst.Get("a"); v != 1 {
+				t.Errorf("Get(a) = %d, want 1", v)
+			}
+			if _, d, _ := dst.GetWithExpiration("b"); d != NoExpiration {
+				t.Errorf("b expires in %v, want NoExpiration", d)
+			}
+			if n := dst.InvalidateTag("even"); n != 1 {
+				t.Errorf("InvalidateTag removed %d items, want the 1 tagged item", n)
+			}
+			if _, ok := dst.Get("gone"); ok {
+				t.Error("Load restored an expired item")
+			}
+		})
+	}
+}
+
+// corruptSnapshot returns a gob snapshot whose header claims items items but
+// holds none.
+func corruptSnapshot(t *testing.T, items int) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	header := snapshotHeader{Version: snapshotVersion, SavedAt: time.Now(), Items: items}
+	if err := GobCodec.NewEncoder(&b).Encode(header); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestLoadRejectsBadItemCounts(t *testing.T) {
+	for _, items := range []int{-1, 1 << 40} {
+		c := newCache(t, time.Minute)
+		c.Set("kept", 1)
+		if err := c.Load(bytes.NewReader(corruptSnapshot(t, items))); err == nil {
+			t.Errorf("Load of a snapshot claiming %d items but holding none succeeded", items)
+		}
+		if v, ok := c.Get("kept"); !ok || v != 1 {
+			t.Errorf("a failed Load changed the cache: Get = %d, %v", v, ok)
+		}
+	}
+}
+
+func TestAutoSaveRestoresCorruptSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	if err := os.WriteFile(path, corruptSnapshot(t, -1), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var persistErr error
+	c := newCache(t, time.Minute, WithAutoSave(path, func(err error) { persistErr = err }))
+	if persistErr == nil {
+		t.Error("New restored a snapshot with a negative item count without reporting it")
+	}
+	if n := c.Len(); n != 0 {
+		t.Errorf("Len after a failed restore = %d, want 0", n)
+	}
+}
@@ -0,0 +1,136 @@
+package cache
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// counters are updated with atomics so that recording a hit never needs the
+// cache's write lock.
+type counters struct {
+	hits          atomic.Uint64
+	misses        atomic.Uint64
+	sets          atomic.Uint64
+	deletes       atomic.Uint64
+	expirations   atomic.Uint64
+	evictions     atomic.Uint64
+	rejections    atomic.Uint64
+	loadSuccesses atomic.Uint64
+	loadFailures  atomic.Uint64
+	loadTime      atomic.Int64
+}
+
+// Stats is a snapshot of a cache's counters since it was created.
+type Stats struct {
+	Hits          uint64 // Gets that found an unexpired item
+	Misses        uint64 // Gets that found nothing
+	Sets          uint64 // values stored, including by loads and refreshes
+	Deletes       uint64 // items removed by Delete, Clear or Close
+	Expirations   uint64 // items removed because their TTL passed
+	Evictions     uint64 // items evicted to stay within capacity
+	Rejections    uint64 // Sets refused by a bounded cache
+	LoadSuccesses uint64 // GetOrLoad and refresh loads that returned a value
+	LoadFailures  uint64 // GetOrLoad and refresh loads that returned an error
+	LoadTime      time.Duration
+}
+
+// HitRatio returns the fraction of Gets that were hits, or 0 before the
+// first Get.
+func (s Stats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// AverageLoadTime returns the mean duration of a load.
+func (s Stats) AverageLoadTime() time.Duration {
+	loads := s.LoadSuccesses + s.LoadFailures
+	if loads == 0 {
+		return 0
+	}
+	return s.LoadTime / time.Duration(loads)
+}
+
+// Stats returns a snapshot of the cache's counters. The counters are read
+// one by one, so a snapshot taken under load may be slightly inconsistent.
+func (c *Cache[K, V]) Stats() Stats {
+	return Stats{
+		Hits:          c.stats.hits.Load(),
+		Misses:        c.stats.misses.Load(),
+		Sets:          c.stats.sets.Load(),
+		Deletes:       c.stats.deletes.Load(),
+		Expirations:   c.stats.expirations.Load(),
+		Evictions:     c.stats.evictions.Load(),
+		Rejections:    c.stats.rejections.Load(),
+		LoadSuccesses: c.stats.loadSuccesses.Load(),
+		LoadFailures:  c.stats.loadFailures.Load(),
+		LoadTime:      time.Duration(c.stats.loadTime.Load()),
+	}
+}
+
+func (s *counters) recordEviction(reason EvictionReason) {
+	switch reason {
+	case ReasonExpired:
+		s.expirations.Add(1)
+	case ReasonDeleted:
+		s.deletes.Add(1)
+	case ReasonCapacity:
+		s.evictions.Add(1)
+	}
+}
+
+func (s *counters) recordLoad(start time.Time, err error) {
+	s.loadTime.Add(int64(time.Since(start)))
+	if err != nil {
+		s.loadFailures.Add(1)
+	} else {
+		s.loadSuccesses.Add(1)
+	}
+}
+
+// WritePrometheus writes the snapshot in the Prometheus text exposition
+// format, with every metric name prefixed by namespace and an underscore
+// unless namespace is empty.
+func (s Stats) WritePrometheus(w io.Writer, namespace string) error {
+	metrics := []struct {
+		name, help string
+		value      float64
+	}{
+		{"hits_total", "Gets that found an unexpired item.", float64(s.Hits)},
+		{"misses_total", "Gets that found nothing.", float64(s.Misses)},
+		{"sets_total", "Values stored.", float64(s.Sets)},
+		{"deletes_total", "Items removed by Delete, Clear or Close.", float64(s.Deletes)},
+		{"expirations_total", "Items removed because their TTL passed.", float64(s.Expirations)},
+		{"evictions_total", "Items evicted to stay within capacity.", float64(s.Evictions)},
+		{"rejections_total", "Sets refused by a bounded cache.", float64(s.Rejections)},
+		{"load_successes_total", "Loads that returned a value.", float64(s.LoadSuccesses)},
+		{"load_failures_total", "Loads that returned an error.", float64(s.LoadFailures)},
+		{"load_seconds_total", "Time spent in loads.", s.LoadTime.Seconds()},
+	}
+	if namespace != "" {
+		namespace += "_"
+	}
+	for _, m := range metrics {
+		name := namespace + m.name
+		_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %g\n", name, m.help, name, name, m.value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PrometheusHandler serves the cache's counters for Prometheus to scrape,
+// without depending on the Prometheus client library:
+//
+//	http.Handle("/metrics", cache.PrometheusHandler("sessions_cache", sessions.Stats))
+func PrometheusHandler(namespace string, stats func() Stats) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		stats().WritePrometheus(w, namespace)
+	})
+}
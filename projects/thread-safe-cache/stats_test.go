@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	c := newCache(t, time.Minute, WithMaxCost(2), WithCleanupInterval(5*time.Millisecond))
+	c.Set("a", 1)
+	c.Get("a")
+	c.Get("a")
+	c.Get("missing")
+	c.Delete("a")
+	c.SetWithTTL("short", 1, time.Millisecond)
+	c.Set("b", 2)
+	c.Set("c", 3) // evicts short, or short has expired already
+	c.GetOrLoad(context.Background(), "d", func(context.Context) (int, error) { return 4, nil })
+	c.GetOrLoad(context.Background(), "e", func(context.Context) (int, error) { return 0, errors.New("down") })
+
+	s := c.Stats()
+	for _, counter := range []struct {
+		name      string
+		got, want uint64
+	}{
+		{"Hits", s.Hits, 2},
+		{"Misses", s.Misses, 3}, // missing, and the two GetOrLoad misses
+		{"Sets", s.Sets, 5},     // a, short, b, c and the loaded d
+		{"Deletes", s.Deletes, 1},
+		{"LoadSuccesses", s.LoadSuccesses, 1},
+		{"LoadFailures", s.LoadFailures, 1},
+	} {
+		if counter.got != counter.want {
+			t.Errorf("%s = %d, want %d", counter.name, counter.got, counter.want)
+		}
+	}
+	// short leaves either by expiring or by being evicted, then b for d.
+	if s.Expirations+s.Evictions != 2 {
+		t.Errorf("Expirations + Evictions = %d + %d, want 2", s.Expirations, s.Evictions)
+	}
+	if got, want := s.HitRatio(), 2.0/5; got != want {
+		t.Errorf("HitRatio = %v, want %v", got, want)
+	}
+	if s.LoadTime <= 0 || s.AverageLoadTime() != s.LoadTime/2 {
+		t.Errorf("LoadTime = %v, AverageLoadTime = %v; want a positive total and its half", s.LoadTime, s.AverageLoadTime())
+	}
+
+	c.Set("big", 1)
+	c.SetCostFunc(func(key string, _ int) int64 { return int64(len(key)) })
+	c.Set("too-big", 1)
+	if n := c.Stats().Rejections; n != 1 {
+		t.Errorf("Rejections = %d, want 1", n)
+	}
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	c := newCache(t, time.Minute)
+	c.Set("a", 1)
+	c.Get("a")
+	c.Get("b")
+
+	rec := httptest.NewRecorder()
+	PrometheusHandler("sessions", c.Stats).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# HELP sessions_hits_total Gets that found an unexpired item.",
+		"# TYPE sessions_hits_total counter",
+		"sessions_hits_total 1",
+		"sessions_misses_total 1",
+		"sessions_sets_total 1",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, body)
+		}
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q, want text/plain", ct)
+	}
+
+	var b strings.Builder
+	c.Stats().WritePrometheus(&b, "")
+	if !strings.HasPrefix(b.String(), "# HELP hits_total ") {
+		t.Errorf("without a namespace the output starts %q, want bare metric names", b.String()[:30])
+	}
+}
@@ -0,0 +1,185 @@
+package cache
+
+import "time"
+
+// Tags group items so they can be invalidated together, for example every
+// item of one tenant. The cache keeps a secondary index from each tag to its
+// keys, so InvalidateTag only touches the items it removes. For string keys,
+// WithPrefixIndex keeps a trie of the keys so InvalidatePrefix can do the
+// same for key namespaces such as "tenant:42:".
+
+// SetWithTags is like SetWithTTL and additionally tags the item. The tags
+// replace those of any previous value stored under key.
+func (c *Cache[K, V]) SetWithTags(key K, value V, ttl time.Duration, tags ...string) {
+	c.set(key, value, ttl, tags, false)
+}
+
+// setLoaded stores a value produced by GetOrLoad with the default TTL. A
+// loader knows nothing of tags, so the value keeps those of the one it
+// replaces, even if that one has expired; otherwise InvalidateTag would miss
+// reloaded items. Refreshes go through storeRefresh instead.
+func (c *Cache[K, V]) setLoaded(key K, value V) {
+	c.set(key, value, DefaultExpiration, nil, true)
+}
+
+func (c *Cache[K, V]) set(key K, value V, ttl time.Duration, tags []string, keepTags bool) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	if old, exists := c.items[key]; exists && keepTags {
+		tags = old.tags
+	}
+	evicted, item := c.setLocked(key, value, ttl, time.Now(), nil)
+	if item != nil {
+		c.tagLocked(item, tags)
+	}
+	onEvicted := c.onEvicted
+	c.mu.Unlock()
+
+	notify(onEvicted, evicted)
+}
+
+// Tags returns the tags of the item stored under key.
+func (c *Cache[K, V]) Tags(key K) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	item, exists := c.items[key]
+	if !exists || item.expired(time.Now().UnixNano()) {
+		return nil
+	}
+	return append([]string(nil), item.tags...)
+}
+
+// InvalidateTag deletes every item tagged with tag and returns how many it
+// deleted. The OnEvicted callback sees them as deleted.
+func (c *Cache[K, V]) InvalidateTag(tag string) int {
+	c.mu.Lock()
+	items := make([]*cacheItem[K, V], 0, len(c.tags[tag]))
+	for key := range c.tags[tag] {
+		items = append(items, c.items[key])
+	}
+	return c.invalidateLocked(items)
+}
+
+// InvalidatePrefix deletes every item whose key starts with prefix and
+// returns how many it deleted. The cache must have been created with
+// WithPrefixIndex; without it InvalidatePrefix scans every key, and it
+// panics if the keys are not strings.
+func (c *Cache[K, V]) InvalidatePrefix(prefix string) int {
+	c.mu.Lock()
+	var items []*cacheItem[K, V]
+	if c.prefixes != nil {
+		c.prefixes.walk(prefix, func(key string) {
+			items = append(items, c.items[any(key).(K)])
+		})
+	} else {
+		for key, item := range c.items {
+			if s := any(key).(string); len(s) >= len(prefix) && s[:len(prefix)] == prefix {
+				items = append(items, item)
+			}
+		}
+	}
+	return c.invalidateLocked(items)
+}
+
+// invalidateLocked removes items, unlocks c.mu and reports the evictions.
+func (c *Cache[K, V]) invalidateLocked(items []*cacheItem[K, V]) int {
+	var evicted []eviction[K, V]
+	now := time.Now().UnixNano()
+	for _, item := range items {
+		c.removeLocked(item)
+		reason := ReasonDeleted
+		if item.expired(now) {
+			reason = ReasonExpired
+		}
+		evicted = c.evictedLocked(evicted, item, reason)
+	}
+	onEvicted := c.onEvicted
+	c.mu.Unlock()
+
+	notify(onEvicted, evicted)
+	return len(items)
+}
+
+// tagLocked replaces the tags of item in the tag index.
+func (c *Cache[K, V]) tagLocked(item *cacheItem[K, V], tags []string) {
+	c.untagLocked(item)
+	if len(tags) == 0 {
+		return
+	}
+	item.tags = append([]string(nil), tags...)
+	for _, tag := range item.tags {
+		keys, ok := c.tags[tag]
+		if !ok {
+			keys = make(map[K]struct{})
+			c.tags[tag] = keys
+		}
+		keys[item.key] = struct{}{}
+	}
+}
+
+func (c *Cache[K, V]) untagLocked(item *cacheItem[K, V]) {
+	for _, tag := range item.tags {
+		keys := c.tags[tag]
+		delete(keys, item.key)
+		if len(keys) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+	item.tags = nil
+}
+
+// keyTrie is a byte-wise prefix tree of the cache's string keys.
+type keyTrie struct {
+	children map[byte]*keyTrie
+	terminal bool // a key ends here
+}
+
+func (t *keyTrie) insert(key string) {
+	node := t
+	for i := 0; i < len(key); i++ {
+		child, ok := node.children[key[i]]
+		if !ok {
+			if node.children == nil {
+				node.children = make(map[byte]*keyTrie)
+			}
+			child = &keyTrie{}
+			node.children[key[i]] = child
+		}
+		node = child
+	}
+	node.terminal = true
+}
+
+// remove deletes key and prunes the nodes that no longer lead to a key. It
+// reports whether t itself has become empty.
+func (t *keyTrie) remove(key string) bool {
+	if key == "" {
+		t.terminal = false
+	} else if child, ok := t.children[key[0]]; ok && child.remove(key[1:]) {
+		delete(t.children, key[0])
+	}
+	return !t.terminal && len(t.children) == 0
+}
+
+// walk calls fn with every key that starts with prefix.
+func (t *keyTrie) walk(prefix string, fn func(key string)) {
+	node := t
+	for i := 0; i < len(prefix); i++ {
+		if node = node.children[prefix[i]]; node == nil {
+			return
+		}
+	}
+	node.collect([]byte(prefix), fn)
+}
+
+func (t *keyTrie) collect(key []byte, fn func(key string)) {
+	if t.terminal {
+		fn(string(key))
+	}
+	for b, child := range t.children {
+		child.collect(append(key, b), fn)
+	}
+}
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestInvalidateTagAndPrefix(t *testing.T) {
+	c := newCache(t, time.Minute, WithPrefixIndex())
+	c.SetWithTags("tenant:1:a", 1, DefaultExpiration, "tenant:1")
+	c.SetWithTags("tenant:1:b", 2, DefaultExpiration, "tenant:1", "b")
+	c.SetWithTags("tenant:2:b", 3, DefaultExpiration, "tenant:2", "b")
+
+	if n := c.InvalidateTag("b"); n != 2 {
+		t.Errorf("InvalidateTag(b) = %d, want 2", n)
+	}
+	if n := c.InvalidatePrefix("tenant:1:"); n != 1 {
+		t.Errorf("InvalidatePrefix(tenant:1:) = %d, want the 1 item left", n)
+	}
+	if n := c.Len(); n != 0 {
+		t.Errorf("Len = %d, want 0", n)
+	}
+
+	c.SetWithTags("k", 1, DefaultExpiration, "old")
+	c.Set("k", 2)
+	if tags := c.Tags("k"); len(tags) != 0 {
+		t.Errorf("Tags after a plain Set = %v, want none", tags)
+	}
+}
+
+// TestLoadsKeepTags checks that values stored by a refresh or a load keep
+// the tags of the value they replace, so InvalidateTag still finds them.
+func TestLoadsKeepTags(t *testing.T) {
+	t.Run("refresh", func(t *testing.T) {
+		c := newCache(t, time.Minute, WithSoftTTL(10*time.Millisecond))
+		c.SetLoader(func(context.Context, string) (int, error) { return 2, nil })
+		c.SetWithTags("k", 1, DefaultExpiration, "t")
+		time.Sleep(20 * time.Millisecond)
+		c.Get("k") // stale: starts the refresh
+		for start := time.Now(); ; time.Sleep(time.Millisecond) {
+			if v, _ := c.Get("k"); v == 2 {
+				break
+			}
+			if time.Since(start) > time.Second {
+				t.Fatal("the stale item was not refreshed")
+			}
+		}
+		if tags := c.Tags("k"); fmt.Sprint(tags) != "[t]" {
+			t.Errorf("Tags after the refresh = %v, want [t]", tags)
+		}
+	})
+
+	t.Run("load", func(t *testing.T) {
+		c := newCache(t, time.Minute)
+		c.SetWithTags("k", 1, time.Millisecond, "t")
+		time.Sleep(5 * time.Millisecond)
+		v, err := c.GetOrLoad(context.Background(), "k", func(context.Context) (int, error) { return 2, nil })
+		if err != nil || v != 2 {
+			t.Fatalf("GetOrLoad = %d, %v; want 2", v, err)
+		}
+		if n := c.InvalidateTag("t"); n != 1 {
+			t.Errorf("InvalidateTag after the load = %d, want the loaded item", n)
+		}
+	})
+}
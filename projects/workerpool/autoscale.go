@@ -0,0 +1,131 @@
+package workerpool
+
+import (
+	"math"
+	"time"
+)
+
+// AutoscalePolicy tells the pool when to add and remove workers. Every
+// Interval the autoscaler looks at the jobs waiting in the queue and at how
+// long the jobs started since the last look had waited:
+//
+//   - It scales up when more than MaxQueuePerWorker jobs are waiting per
+//     worker, or jobs waited longer than TargetWait on average. The new
+//     size is what would bring both back under their limits, so a sudden
+//     100x burst is met in one step rather than one worker at a time.
+//   - It scales down when nothing is waiting and the workers were busy less
+//     than ScaleDownUtilization of the time, to the size that would have
+//     been busy about that much, but by at least one worker.
+//
+// Cooldowns keep it from flapping: no scale-up within ScaleUpCooldown of
+// the previous one, and no scale-down within ScaleDownCooldown of any
+// change. Scaling up is cheap and urgent, scaling down is neither, so the
+// down cooldown is much longer by default.
+type AutoscalePolicy struct {
+	Min, Max int // bounds on the worker count; Min defaults to 1
+
+	Interval             time.Duration // default 1s
+	TargetWait           time.Duration // default 100ms
+	MaxQueuePerWorker    int           // default 4
+	ScaleDownUtilization float64       // default 0.5
+	ScaleUpCooldown      time.Duration // default Interval
+	ScaleDownCooldown    time.Duration // default 30s
+
+	// OnScale, if set, is called after every resize made by the
+	// autoscaler.
+	OnScale func(from, to int)
+}
+
+func (a AutoscalePolicy) withDefaults() AutoscalePolicy {
+	a.Min = max(a.Min, 1)
+	a.Max = max(a.Max, a.Min)
+	if a.Interval <= 0 {
+		a.Interval = time.Second
+	}
+	if a.TargetWait <= 0 {
+		a.TargetWait = 100 * time.Millisecond
+	}
+	if a.MaxQueuePerWorker <= 0 {
+		a.MaxQueuePerWorker = 4
+	}
+	if a.ScaleDownUtilization <= 0 || a.ScaleDownUtilization > 1 {
+		a.ScaleDownUtilization = 0.5
+	}
+	if a.ScaleUpCooldown <= 0 {
+		a.ScaleUpCooldown = a.Interval
+	}
+	if a.ScaleDownCooldown <= 0 {
+		a.ScaleDownCooldown = 30 * time.Second
+	}
+	return a
+}
+
+// autoscale resizes the pool according to policy until the pool stops.
+func (p *Pool[In, Out]) autoscale(policy AutoscalePolicy) {
+	ticker := time.NewTicker(policy.Interval)
+	defer ticker.Stop()
+
+	last := time.Now()
+	var lastUp, lastChange time.Time
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		elapsed := now.Sub(last)
+		last = now
+		started := p.started.Swap(0)
+		waitSum := p.waitSum.Swap(0)
+		execSum := p.execSum.Swap(0)
+		workers := p.Workers()
+		var depth int
+		for _, d := range p.queue.Depths() {
+			depth += d.Depth
+		}
+
+		var avgWait time.Duration
+		if started > 0 {
+			avgWait = time.Duration(waitSum / started)
+		}
+		// execSum only covers jobs that finished in this interval; the jobs
+		// still running keep their workers busy too.
+		utilization := math.Max(
+			float64(execSum)/(float64(workers)*float64(elapsed)),
+			float64(p.busy.Load())/float64(workers))
+
+		desired := workers
+		switch {
+		case depth > workers*policy.MaxQueuePerWorker || avgWait > policy.TargetWait:
+			if now.Sub(lastUp) < policy.ScaleUpCooldown {
+				continue
+			}
+			desired = max(workers+1,
+				ceilDiv(depth, policy.MaxQueuePerWorker),
+				int(math.Ceil(float64(workers)*float64(avgWait)/float64(policy.TargetWait))))
+			lastUp = now
+		case depth == 0 && utilization < policy.ScaleDownUtilization:
+			if now.Sub(lastChange) < policy.ScaleDownCooldown {
+				continue
+			}
+			desired = min(workers-1,
+				int(math.Ceil(float64(workers)*utilization/policy.ScaleDownUtilization)))
+		}
+
+		desired = min(max(desired, policy.Min), policy.Max)
+		if desired == workers {
+			continue
+		}
+		p.Resize(desired)
+		lastChange = now
+		if policy.OnScale != nil {
+			policy.OnScale(workers, desired)
+		}
+	}
+}
+
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-cookbook/projects/workerpool"
+)
+
+var errNegative = errors.New("negative value")
+
+func main() {
+	ctx := context.Background()
+	pool := workerpool.New(func(ctx context.Context, value int) (int, error) {
+		// Simulate work with a sleep that gives up when the job is cancelled
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+		if value < 0 {
+			return 0, errNegative
+		}
+		return value * 2, nil
+	}, workerpool.WithWorkers(3), workerpool.WithQueueSize(10), workerpool.WithJobTimeout(time.Second))
+
+	// Dispatch jobs; the last one gets a deadline it cannot meet
+	go func() {
+		for j := 1; j <= 5; j++ {
+			pool.Submit(ctx, j*10)
+		}
+		pool.Submit(ctx, -1)
+		pool.Submit(ctx, 60, workerpool.Timeout(10*time.Millisecond))
+		if err := pool.Shutdown(ctx); err == nil {
+			fmt.Println("Drained gracefully")
+		}
+	}()
+
+	// Retrieve and print results until Shutdown closes the channel
+	for res := range pool.Results() {
+		if res.Err != nil {
+			fmt.Printf("Result: JobID %d, Input %d, Error %v\n", res.JobID, res.Input, res.Err)
+			continue
+		}
+		fmt.Printf("Result: JobID %d, Output %d\n", res.JobID, res.Output)
+	}
+
+	if _, err := pool.Submit(ctx, 1); errors.Is(err, workerpool.ErrClosed) {
+		fmt.Println("Submit after Shutdown:", err)
+	}
+
+	// Retries: a flaky service fails twice per order before succeeding, so
+	// three attempts are enough; an unknown order is a permanent failure and
+	// goes straight to the dead-letter list.
+	var calls sync.Map
+	var deadMu sync.Mutex
+	var dead []workerpool.DeadLetter[string]
+	orders := workerpool.New(func(ctx context.Context, order string) (string, error) {
+		n, _ := calls.LoadOrStore(order, new(int32))
+		if order == "unknown" {
+			return "", workerpool.Permanent(errors.New("no such order"))
+		}
+		if atomic.AddInt32(n.(*int32), 1) <= 2 {
+			return "", errors.New("service unavailable")
+		}
+		return order + " shipped", nil
+	},
+		workerpool.WithWorkers(2),
+		workerpool.WithRetry(workerpool.RetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: 20 * time.Millisecond,
+			Jitter:         0.5,
+		}))
+	orders.OnDeadLetter(func(dl workerpool.DeadLetter[string]) {
+		deadMu.Lock()
+		dead = append(dead, dl)
+		deadMu.Unlock()
+	})
+	for _, order := range []string{"order-1", "order-2", "unknown"} {
+		orders.Submit(ctx, order)
+	}
+	go orders.Shutdown(ctx)
+	for res := range orders.Results() {
+		fmt.Printf("Order %s: %q after %d attempt(s), err %v\n", res.Input, res.Output, len(res.Attempts), res.Err)
+	}
+	for _, dl := range dead {
+		fmt.Printf("Dead letter: job %d %q, %d attempt(s): %v\n", dl.JobID, dl.Input, len(dl.Attempts), dl.Err)
+	}
+
+	// Priorities and fair queuing: one worker, a flood of batch jobs from
+	// "bulk", a few from "acme" (weight 2) and one urgent job. The worker is
+	// held until everything is queued so the scheduling order is visible.
+	start := make(chan struct{})
+	fair := workerpool.New(func(ctx context.Context, name string) (string, error) {
+		<-start
+		return name, nil
+	}, workerpool.WithWorkers(1), workerpool.WithQueueSize(20), workerpool.WithTenantWeight("acme", 2))
+	fair.Submit(ctx, "warmup")
+	for len(fair.QueueDepths()) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 1; i <= 6; i++ {
+		fair.Submit(ctx, fmt.Sprintf("bulk-%d", i), workerpool.ForTenant("bulk"), workerpool.AtPriority(workerpool.PriorityLow))
+	}
+	for i := 1; i <= 4; i++ {
+		fair.Submit(ctx, fmt.Sprintf("acme-%d", i), workerpool.ForTenant("acme"), workerpool.AtPriority(workerpool.PriorityLow))
+	}
+	fair.Submit(ctx, "page-oncall", workerpool.AtPriority(workerpool.PriorityUrgent))
+	for _, d := range fair.QueueDepths() {
+		fmt.Printf("Queued: %s/%q %d\n", d.Priority, d.Tenant, d.Depth)
+	}
+	close(start)
+	go fair.Shutdown(ctx)
+	var order []string
+	for res := range fair.Results() {
+		order = append(order, res.Output)
+	}
+	fmt.Println("Run order:", order)
+
+	// Autoscaling: a burst of 200 jobs grows the pool from one worker, and
+	// it shrinks back once the burst is over.
+	elastic := workerpool.New(func(ctx context.Context, n int) (int, error) {
+		time.Sleep(20 * time.Millisecond)
+		return n, nil
+	},
+		workerpool.WithWorkers(1),
+		workerpool.WithQueueSize(200),
+		workerpool.WithAutoscale(workerpool.AutoscalePolicy{
+			Min:               1,
+			Max:               16,
+			Interval:          100 * time.Millisecond,
+			ScaleDownCooldown: 300 * time.Millisecond,
+			OnScale: func(from, to int) {
+				fmt.Printf("Autoscaler: %d -> %d workers\n", from, to)
+			},
+		}))
+	go func() {
+		for range elastic.Results() {
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		elastic.Submit(ctx, i)
+	}
+	time.Sleep(1500 * time.Millisecond)
+	elastic.Resize(4)
+	fmt.Println("Resized by hand to", elastic.Workers())
+	elastic.Shutdown(ctx)
+
+	// Durable queue: jobs live in a log on disk. The first pool is stopped
+	// before it gets anywhere, as if the process had been killed; a second
+	// pool opening the same directory runs the jobs it left behind.
+	dir, err := os.MkdirTemp("", "workerpool")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	invoices := func(ctx context.Context, invoice string) (string, error) {
+		return invoice + " sent", nil
+	}
+	queue, err := workerpool.OpenFileQueue(dir, workerpool.JSONCodec[string]())
+	if err != nil {
+		panic(err)
+	}
+	blocked := workerpool.New(func(ctx context.Context, invoice string) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}, workerpool.WithWorkers(1), workerpool.WithQueue(queue))
+	for _, invoice := range []string{"invoice-1", "invoice-2", "invoice-3"} {
+		blocked.Submit(ctx, invoice, workerpool.IdempotencyKey(invoice))
+	}
+	if earlier, err := blocked.Submit(ctx, "invoice-2", workerpool.IdempotencyKey("invoice-2")); errors.Is(err, workerpool.ErrDuplicate) {
+		fmt.Println("Duplicate of job", earlier.ID())
+	}
+	go func() {
+		for range blocked.Results() {
+		}
+	}()
+	killCtx, kill := context.WithCancel(ctx)
+	kill()
+	blocked.Shutdown(killCtx)
+
+	queue, err = workerpool.OpenFileQueue(dir, workerpool.JSONCodec[string]())
+	if err != nil {
+		panic(err)
+	}
+	restarted := workerpool.New(invoices, workerpool.WithWorkers(1), workerpool.WithQueue(queue))
+	go restarted.Shutdown(ctx)
+	for res := range restarted.Results() {
+		fmt.Printf("After restart: JobID %d, %q\n", res.JobID, res.Output)
+	}
+
+	// Ordered results: later jobs finish first, but results come out in
+	// submission order, with at most 4 jobs between Submit and their result.
+	sleepy := func(ctx context.Context, ms int) (int, error) {
+		time.Sleep(time.Duration(ms) * time.Millisecond)
+		return ms, nil
+	}
+	ordered := workerpool.New(sleepy, workerpool.WithWorkers(4), workerpool.WithOrderedResults(4))
+	go func() {
+		for _, ms := range []int{80, 60, 40, 20, 10, 5} {
+			ordered.Submit(ctx, ms)
+		}
+		ordered.Shutdown(ctx)
+	}()
+	var outputs []int
+	for res := range ordered.Results() {
+		outputs = append(outputs, res.Output)
+	}
+	fmt.Println("Ordered results:", outputs)
+
+	// Futures: wait for one particular job without touching Results.
+	lookups := workerpool.New(sleepy, workerpool.WithWorkers(2), workerpool.WithoutResults())
+	slow, _ := lookups.Submit(ctx, 50)
+	fast, _ := lookups.Submit(ctx, 10)
+	res, _ := slow.Wait(ctx)
+	fmt.Printf("Future: job %d returned %d (job %d done: %v)\n", slow.ID(), res.Output, fast.ID(), isDone(fast.Done()))
+	lookups.Shutdown(ctx)
+
+	// Observability: hooks see every step of a job, metrics show whether
+	// batch jobs are slow because they wait or because they run long, and a
+	// tracer gets a span per job and per attempt.
+	var eventMu sync.Mutex
+	events := make(map[workerpool.EventKind]int)
+	var spans atomic.Int32
+	flaky := workerpool.New(func(ctx context.Context, n int) (int, error) {
+		time.Sleep(time.Duration(n) * time.Millisecond)
+		if n%5 == 0 {
+			return 0, errors.New("transient")
+		}
+		return n, nil
+	},
+		workerpool.WithWorkers(2),
+		workerpool.WithQueueSize(30),
+		workerpool.WithRetry(workerpool.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}),
+		workerpool.WithHook(func(e workerpool.Event) {
+			eventMu.Lock()
+			events[e.Kind]++
+			eventMu.Unlock()
+			if e.Kind == workerpool.EventRetried {
+				fmt.Printf("Hook: job %d attempt %d failed (%v), retrying in %v\n", e.JobID, e.Attempt, e.Err, e.Backoff)
+			}
+		}),
+		workerpool.WithTracer(countingTracer{&spans}))
+	go func() {
+		for range flaky.Results() {
+		}
+	}()
+	for i := 1; i <= 12; i++ {
+		flaky.Submit(ctx, i, workerpool.ForTenant("batch"), workerpool.AtPriority(workerpool.PriorityLow))
+	}
+	flaky.Shutdown(ctx)
+	m := flaky.Metrics()
+	fmt.Printf("Events: queued %d, started %d, succeeded %d, failed %d, retried %d\n",
+		events[workerpool.EventQueued], events[workerpool.EventStarted], events[workerpool.EventSucceeded],
+		events[workerpool.EventFailed], events[workerpool.EventRetried])
+	fmt.Printf("Metrics: %d succeeded, %d failed; queue wait p50 %v, p99 %v; attempt p50 %v; utilization %.0f%%\n",
+		m.Succeeded, m.Failed, m.QueueWait.Quantile(0.5), m.QueueWait.Quantile(0.99),
+		m.ExecTime.Quantile(0.5), 100*m.Utilization())
+	fmt.Println("Spans:", spans.Load())
+	var prom strings.Builder
+	m.WritePrometheus(&prom, "batch")
+	for _, line := range strings.Split(prom.String(), "\n") {
+		if strings.HasPrefix(line, "batch_jobs_") {
+			fmt.Println("Prometheus:", line)
+		}
+	}
+
+	// A stuck handler that ignores its context: Shutdown gives up after its
+	// deadline, the running job is abandoned and the queued ones are failed.
+	stuck := workerpool.New(func(ctx context.Context, value int) (int, error) {
+		time.Sleep(time.Hour)
+		return value, nil
+	}, workerpool.WithWorkers(1))
+	for j := 1; j <= 3; j++ {
+		stuck.Submit(ctx, j)
+	}
+	printed := make(chan struct{})
+	go func() {
+		defer close(printed)
+		for res := range stuck.Results() {
+			fmt.Printf("Stuck pool: JobID %d, Error %v (stopped: %v)\n",
+				res.JobID, res.Err, errors.Is(res.Err, workerpool.ErrStopped))
+		}
+	}()
+	shutdownCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	err = stuck.Shutdown(shutdownCtx)
+	<-printed
+	fmt.Println("Forced stop:", err)
+}
+
+func isDone(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
+
+// countingTracer counts spans; a real one would wrap an OpenTelemetry
+// tracer.
+type countingTracer struct{ n *atomic.Int32 }
+
+func (t countingTracer) Start(ctx context.Context, name string, attrs ...workerpool.Attribute) (context.Context, workerpool.Span) {
+	t.n.Add(1)
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...workerpool.Attribute)    {}
+func (noopSpan) AddEvent(string, ...workerpool.Attribute) {}
+func (noopSpan) RecordError(error)                        {}
+func (noopSpan) End()                                     {}
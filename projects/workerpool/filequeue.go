@@ -0,0 +1,400 @@
+package workerpool
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Codec converts job inputs to bytes for a durable queue. Unmarshal must
+// return a value of the pool's input type.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte) (any, error)
+}
+
+type gobCodec[T any] struct{}
+
+func (gobCodec[T]) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(v)
+	return buf.Bytes(), err
+}
+
+func (gobCodec[T]) Unmarshal(data []byte) (any, error) {
+	var v T
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return v, err
+}
+
+type jsonCodec[T any] struct{}
+
+func (jsonCodec[T]) Marshal(v any) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec[T]) Unmarshal(data []byte) (any, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// GobCodec encodes inputs of type T with encoding/gob.
+func GobCodec[T any]() Codec { return gobCodec[T]{} }
+
+// JSONCodec encodes inputs of type T with encoding/json.
+func JSONCodec[T any]() Codec { return jsonCodec[T]{} }
+
+// SegmentSize sets the size at which a FileQueue starts a new log segment.
+// The default is 4 MiB.
+func SegmentSize(n int64) QueueOption {
+	return func(c *queueConfig) {
+		c.segmentSize = n
+	}
+}
+
+// NoSync stops a FileQueue from calling fsync after every write. It is much
+// faster, but jobs accepted shortly before a machine crash (not just a
+// process crash) can be lost.
+func NoSync() QueueOption {
+	return func(c *queueConfig) {
+		c.noSync = true
+	}
+}
+
+// OpenFileQueue opens, or creates, a durable queue in dir. Messages that
+// were not acknowledged before the queue was last closed, or before the
+// process died, are delivered again, along with any that were still
+// waiting.
+//
+// The queue is an append-only log split into numbered segment files. Every
+// Enqueue and Ack appends a record, and by default syncs it to disk before
+// returning. Once every message of the oldest segment has been
+// acknowledged, the segment is deleted; acknowledgements always follow the
+// message they refer to, so deleting segments oldest first never revives an
+// acknowledged message. The idempotency keys of acknowledged messages are
+// logged with the acknowledgement, and every new segment starts with the
+// keys still within their retention period, so deleting old segments does
+// not forget them. A record cut short by a crash is ignored and
+// overwritten.
+func OpenFileQueue(dir string, codec Codec, opts ...QueueOption) (Queue, error) {
+	cfg := defaultQueueConfig()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	log := &segmentLog{dir: dir, codec: codec, maxSize: cfg.segmentSize, sync: !cfg.noSync}
+	pending, acked, lastID, err := log.replay()
+	if err != nil {
+		return nil, err
+	}
+
+	q := newMessageQueue(cfg, log)
+	q.nextID = lastID
+	now := time.Now()
+	for _, k := range acked {
+		if now.Sub(k.At) <= cfg.keyRetention {
+			q.acked = append(q.acked, k)
+			q.keys[k.Key] = k.ID
+		}
+	}
+	for _, m := range pending {
+		if m.Key != "" {
+			q.keys[m.Key] = m.ID
+		}
+		q.sched.requeue(m)
+	}
+	log.retained = func() []ackedKey {
+		q.expireKeys(time.Now())
+		return q.acked
+	}
+	if err := log.roll(); err != nil {
+		q.Close()
+		return nil, err
+	}
+	return q, nil
+}
+
+const (
+	recordEnqueue = "enq"
+	recordAck     = "ack"
+	recordKeys    = "keys" // the retained keys, at the start of a segment
+)
+
+// logRecord is one entry of the log, stored as
+//
+//	uint32 length | uint32 CRC-32 of the body | JSON body
+type logRecord struct {
+	Op         string        `json:"op"`
+	ID         uint64        `json:"id"`
+	Priority   Priority      `json:"priority,omitempty"`
+	Tenant     string        `json:"tenant,omitempty"`
+	Key        string        `json:"key,omitempty"`
+	Timeout    time.Duration `json:"timeout,omitempty"`
+	EnqueuedAt time.Time     `json:"enqueued_at,omitempty"`
+	Payload    []byte        `json:"payload,omitempty"`
+	Keys       []ackedKey    `json:"keys,omitempty"` // the acknowledged key for ack, all of them for keys
+}
+
+type segment struct {
+	seq  uint64
+	path string
+	live int // messages enqueued in this segment and not yet acknowledged
+}
+
+// segmentLog is guarded by the messageQueue's mutex.
+type segmentLog struct {
+	dir     string
+	codec   Codec
+	maxSize int64
+	sync    bool
+
+	segments []*segment // oldest first; the last one is active
+	active   *os.File
+	size     int64
+	where    map[uint64]*segment // unacknowledged message ID -> its segment
+
+	// retained returns the acknowledged keys to carry into a new segment.
+	retained func() []ackedKey
+}
+
+func (l *segmentLog) appendEnqueue(m Message) error {
+	payload, err := l.codec.Marshal(m.Payload)
+	if err != nil {
+		return fmt.Errorf("workerpool: encode job: %w", err)
+	}
+	// write may roll over to a new segment after the record.
+	seg := l.segments[len(l.segments)-1]
+	err = l.write(logRecord{
+		Op: recordEnqueue, ID: m.ID, Priority: m.Priority, Tenant: m.Tenant,
+		Key: m.Key, Timeout: m.Timeout, EnqueuedAt: m.EnqueuedAt, Payload: payload,
+	})
+	if err != nil {
+		return err
+	}
+	seg.live++
+	l.where[m.ID] = seg
+	return nil
+}
+
+// appendAck logs the acknowledgement of message id and, if it had one, its
+// idempotency key.
+func (l *segmentLog) appendAck(id uint64, key *ackedKey) error {
+	rec := logRecord{Op: recordAck, ID: id}
+	if key != nil {
+		rec.Keys = []ackedKey{*key}
+	}
+	if err := l.write(rec); err != nil {
+		return err
+	}
+	if seg, ok := l.where[id]; ok {
+		delete(l.where, id)
+		seg.live--
+	}
+	l.compact()
+	return nil
+}
+
+func (l *segmentLog) write(rec logRecord) error {
+	if err := l.writeRecord(rec); err != nil {
+		return err
+	}
+	if l.size >= l.maxSize {
+		return l.roll()
+	}
+	return nil
+}
+
+// writeRecord appends rec to the active segment without rolling over.
+func (l *segmentLog) writeRecord(rec logRecord) error {
+	if l.active == nil {
+		return ErrQueueClosed
+	}
+	body, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	frame := make([]byte, 8+len(body))
+	binary.LittleEndian.PutUint32(frame[0:4], uint32(len(body)))
+	binary.LittleEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(body))
+	copy(frame[8:], body)
+	if _, err := l.active.Write(frame); err != nil {
+		return err
+	}
+	if l.sync {
+		if err := l.active.Sync(); err != nil {
+			return err
+		}
+	}
+	l.size += int64(len(frame))
+	return nil
+}
+
+// roll starts a new active segment.
+func (l *segmentLog) roll() error {
+	var seq uint64 = 1
+	if n := len(l.segments); n > 0 {
+		seq = l.segments[n-1].seq + 1
+	}
+	path := filepath.Join(l.dir, fmt.Sprintf("%020d.log", seq))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if l.active != nil {
+		l.active.Close()
+	}
+	l.active, l.size = f, 0
+	l.segments = append(l.segments, &segment{seq: seq, path: path})
+	if keys := l.retained(); len(keys) > 0 {
+		if err := l.writeRecord(logRecord{Op: recordKeys, Keys: keys}); err != nil {
+			return err
+		}
+	}
+	l.compact()
+	return nil
+}
+
+// compact deletes the oldest segments while all their messages have been
+// acknowledged.
+func (l *segmentLog) compact() {
+	for len(l.segments) > 1 && l.segments[0].live == 0 {
+		os.Remove(l.segments[0].path)
+		l.segments = l.segments[1:]
+	}
+}
+
+func (l *segmentLog) close() {
+	if l.active != nil {
+		l.active.Close()
+		l.active = nil
+	}
+}
+
+// replay reads every segment and returns the messages that were never
+// acknowledged, in the order they were enqueued, the acknowledged keys in
+// acknowledgement order, and the highest message ID seen.
+func (l *segmentLog) replay() ([]Message, []ackedKey, uint64, error) {
+	l.where = make(map[uint64]*segment)
+	names, err := filepath.Glob(filepath.Join(l.dir, "*.log"))
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	sort.Strings(names)
+
+	pending := make(map[uint64]Message)
+	acked := make(map[string]ackedKey)
+	var lastID uint64
+	for _, name := range names {
+		seq, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), ".log"), 10, 64)
+		if err != nil {
+			continue
+		}
+		seg := &segment{seq: seq, path: name}
+		l.segments = append(l.segments, seg)
+		err = l.readSegment(name, func(rec logRecord) error {
+			lastID = max(lastID, rec.ID)
+			switch rec.Op {
+			case recordEnqueue:
+				payload, err := l.codec.Unmarshal(rec.Payload)
+				if err != nil {
+					return fmt.Errorf("workerpool: decode job %d: %w", rec.ID, err)
+				}
+				pending[rec.ID] = Message{
+					ID: rec.ID, Payload: payload, Priority: rec.Priority, Tenant: rec.Tenant,
+					Key: rec.Key, Timeout: rec.Timeout, EnqueuedAt: rec.EnqueuedAt,
+				}
+				seg.live++
+				l.where[rec.ID] = seg
+			case recordAck:
+				if _, ok := pending[rec.ID]; ok {
+					delete(pending, rec.ID)
+					l.where[rec.ID].live--
+					delete(l.where, rec.ID)
+				}
+				for _, k := range rec.Keys {
+					acked[k.Key] = k
+				}
+			case recordKeys:
+				for _, k := range rec.Keys {
+					acked[k.Key] = k
+					lastID = max(lastID, k.ID)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, 0, err
+		}
+	}
+	// Segments are compacted by the roll that follows, once the keys they
+	// hold have been carried into the new segment.
+
+	messages := make([]Message, 0, len(pending))
+	for _, m := range pending {
+		messages = append(messages, m)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID })
+	keys := make([]ackedKey, 0, len(acked))
+	for _, k := range acked {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].At.Before(keys[j].At) })
+	return messages, keys, lastID, nil
+}
+
+// readSegment calls fn with every intact record of a segment. A torn or
+// corrupt record ends the segment; it is truncated there so later appends
+// are not hidden behind it.
+func (l *segmentLog) readSegment(path string, fn func(logRecord) error) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(f)
+	var offset int64
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return f.Truncate(offset)
+		}
+		// A corrupt length must not make us allocate gigabytes.
+		n := int64(binary.LittleEndian.Uint32(header[0:4]))
+		if n > info.Size()-offset-int64(len(header)) {
+			return f.Truncate(offset)
+		}
+		body := make([]byte, n)
+		var rec logRecord
+		if _, err := io.ReadFull(r, body); err != nil ||
+			crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(header[4:8]) ||
+			json.Unmarshal(body, &rec) != nil {
+			return f.Truncate(offset)
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+		offset += int64(len(header) + len(body))
+	}
+}
@@ -0,0 +1,130 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func openFileQueue(t *testing.T, dir string) Queue {
+	t.Helper()
+	q, err := OpenFileQueue(dir, JSONCodec[int](), NoSync())
+	if err != nil {
+		t.Fatalf("OpenFileQueue: %v", err)
+	}
+	return q
+}
+
+// TestFileQueueSurvivesForcedStop stops a pool with jobs running and
+// queued, then reopens its queue in a new pool: the unfinished jobs run
+// again, and idempotency keys of both finished and unfinished jobs are
+// still known.
+func TestFileQueueSurvivesForcedStop(t *testing.T) {
+	dir := t.TempDir()
+	p := New(func(ctx context.Context, n int) (int, error) {
+		if n == 0 {
+			return n, nil
+		}
+		return blocking(ctx, n)
+	}, WithWorkers(1), WithQueue(openFileQueue(t, dir)), WithoutResults())
+	submit(t, p, 0, IdempotencyKey("job-0")).Wait(context.Background())
+	for _, n := range []int{1, 2, 3} {
+		submit(t, p, n, IdempotencyKey(fmt.Sprintf("job-%d", n)))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown = %v, want a forced stop", err)
+	}
+
+	p = New(func(ctx context.Context, n int) (int, error) { return n, nil },
+		WithWorkers(1), WithQueue(openFileQueue(t, dir)))
+	results := collect(p)
+	for _, key := range []string{"job-0", "job-2"} {
+		if _, err := p.Submit(context.Background(), 9, IdempotencyKey(key)); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("Submit with key %s after a restart: %v, want ErrDuplicate", key, err)
+		}
+	}
+	shutdown(t, p)
+
+	var rerun []int
+	for _, res := range <-results {
+		if res.Err != nil {
+			t.Errorf("replayed job %d: %v", res.Input, res.Err)
+		}
+		rerun = append(rerun, res.Input)
+	}
+	sort.Ints(rerun)
+	if fmt.Sprint(rerun) != "[1 2 3]" {
+		t.Errorf("jobs run after the restart: %v, want [1 2 3]", rerun)
+	}
+}
+
+// TestFileQueueTornRecord cuts the last record short, as a crash in the
+// middle of a write would, and checks that reopening drops it, truncates
+// the segment and keeps the records before it.
+func TestFileQueueTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	q := openFileQueue(t, dir)
+	for n := 1; n <= 3; n++ {
+		if _, err := q.Enqueue(context.Background(), Message{Payload: n}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	q.Close()
+
+	segments, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	sort.Strings(segments)
+	last := segments[len(segments)-1]
+	info, err := os.Stat(last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	torn := info.Size() - 5
+	if err := os.Truncate(last, torn); err != nil {
+		t.Fatal(err)
+	}
+
+	// Closed, the queue hands out what it has and then reports that.
+	q = openFileQueue(t, dir)
+	q.Close()
+	var got []any
+	for {
+		m, err := q.Dequeue(context.Background())
+		if errors.Is(err, ErrQueueClosed) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, m.Payload)
+		q.Nack(m.ID)
+	}
+	if len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Errorf("payloads after a torn write: %v, want [1 2]", got)
+	}
+	if info, err := os.Stat(last); err != nil {
+		t.Fatal(err)
+	} else if info.Size() >= torn {
+		t.Errorf("the torn segment is %d bytes, want it truncated before the torn record at %d", info.Size(), torn)
+	}
+
+	// The jobs survive another restart, now that the segment is clean.
+	q = openFileQueue(t, dir)
+	q.Close()
+	n := 0
+	for {
+		if _, err := q.Dequeue(context.Background()); err != nil {
+			break
+		}
+		n++
+	}
+	if n != 2 {
+		t.Errorf("%d jobs after a second restart, want 2", n)
+	}
+}
@@ -0,0 +1,227 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// Future is the Result of a submitted job, once the job is done.
+type Future[In, Out any] struct {
+	id   uint64
+	done chan struct{}
+	res  Result[In, Out]
+}
+
+// ID returns the job's ID, which is repeated in its Result.
+func (f *Future[In, Out]) ID() uint64 {
+	return f.id
+}
+
+// Done returns a channel that is closed once the job's Result is ready.
+func (f *Future[In, Out]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait returns the job's Result once it is ready. If ctx is done first, it
+// returns ctx's error; the job itself carries on.
+func (f *Future[In, Out]) Wait(ctx context.Context) (Result[In, Out], error) {
+	select {
+	case <-f.done:
+		return f.res, nil
+	case <-ctx.Done():
+		return Result[In, Out]{}, ctx.Err()
+	}
+}
+
+// ticket follows a job from Submit to its Result.
+type ticket[In, Out any] struct {
+	future *Future[In, Out]
+	done   bool // the result is in future.res, or the job was never queued
+}
+
+// tracker matches results to the futures of their jobs and, in ordered
+// mode, releases results in submission order.
+//
+// The queue only assigns a job its ID inside Enqueue, so a fast worker can
+// finish a job before Submit learns its ID. Such results wait in early
+// until Submit binds the ID to its ticket. Results of jobs this pool did not
+// submit, such as those replayed from a durable queue, are only known to be
+// foreign once no Submit is between reserve and bind.
+type tracker[In, Out any] struct {
+	mu      sync.Mutex
+	pending map[uint64]*ticket[In, Out] // bound tickets by job ID
+	unbound int                         // reserved tickets without an ID yet
+	early   map[uint64]Result[In, Out]
+
+	// Ordered mode only. order holds the tickets of jobs whose results
+	// have not been emitted yet, in submission order; there are at most
+	// window of them. foreign results are emitted as they come.
+	ordered  bool
+	window   int
+	order    []*ticket[In, Out]
+	foreign  []Result[In, Out]
+	finished bool // the workers have exited
+
+	// changed is closed and replaced on every change, like the
+	// scheduler's channels.
+	changed chan struct{}
+}
+
+func newTracker[In, Out any](ordered bool, window int) *tracker[In, Out] {
+	return &tracker[In, Out]{
+		pending: make(map[uint64]*ticket[In, Out]),
+		early:   make(map[uint64]Result[In, Out]),
+		ordered: ordered,
+		window:  max(window, 1),
+		changed: make(chan struct{}),
+	}
+}
+
+func (t *tracker[In, Out]) notify() {
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+// reserve takes a ticket for a job about to be queued. In ordered mode it
+// waits while the reorder window is full.
+func (t *tracker[In, Out]) reserve(ctx context.Context) (*ticket[In, Out], error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for t.ordered && len(t.order) >= t.window {
+		changed := t.changed
+		t.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			t.mu.Lock()
+			return nil, ctx.Err()
+		}
+		t.mu.Lock()
+	}
+	tk := &ticket[In, Out]{future: &Future[In, Out]{done: make(chan struct{})}}
+	t.unbound++
+	if t.ordered {
+		t.order = append(t.order, tk)
+	}
+	return tk, nil
+}
+
+// bind gives tk the ID the queue assigned, or, if Enqueue failed with err,
+// retires it. For a duplicate it returns the future of the earlier job, if
+// that job is still pending.
+func (t *tracker[In, Out]) bind(tk *ticket[In, Out], id uint64, err error) *Future[In, Out] {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	defer t.notify()
+
+	t.unbound--
+	var earlier *Future[In, Out]
+	switch res, ok := t.early[id]; {
+	case err != nil:
+		tk.done = true
+		if prev, ok := t.pending[id]; ok && errors.Is(err, ErrDuplicate) {
+			earlier = prev.future
+		}
+	case ok:
+		delete(t.early, id)
+		tk.future.id = id
+		tk.resolve(res)
+	default:
+		tk.future.id = id
+		t.pending[id] = tk
+	}
+
+	if t.unbound == 0 && len(t.early) > 0 {
+		ids := make([]uint64, 0, len(t.early))
+		for id := range t.early {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		for _, id := range ids {
+			if t.ordered {
+				t.foreign = append(t.foreign, t.early[id])
+			}
+			delete(t.early, id)
+		}
+	}
+	return earlier
+}
+
+// complete records the result of a finished job.
+func (t *tracker[In, Out]) complete(res Result[In, Out]) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tk, ok := t.pending[res.JobID]
+	switch {
+	case ok:
+		delete(t.pending, res.JobID)
+		tk.resolve(res)
+	case t.unbound > 0:
+		t.early[res.JobID] = res
+		return
+	case t.ordered:
+		t.foreign = append(t.foreign, res)
+	default:
+		return
+	}
+	t.notify()
+}
+
+func (tk *ticket[In, Out]) resolve(res Result[In, Out]) {
+	tk.future.res = res
+	tk.done = true
+	close(tk.future.done)
+}
+
+// finish tells the tracker the workers have exited, so no more results
+// will come.
+func (t *tracker[In, Out]) finish() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.finished = true
+	t.notify()
+}
+
+// next returns the next result to emit in ordered mode, waiting until
+// there is one. It returns false once the workers have exited and every
+// result has been emitted.
+func (t *tracker[In, Out]) next() (Result[In, Out], bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for {
+		if len(t.foreign) > 0 {
+			res := t.foreign[0]
+			t.foreign = t.foreign[1:]
+			return res, true
+		}
+		// Once the workers are gone, a job still without a result never
+		// reached them; it must not hold up the rest.
+		for len(t.order) > 0 && (t.order[0].done || t.finished && t.unbound == 0) {
+			tk := t.order[0]
+			t.order[0] = nil
+			t.order = t.order[1:]
+			t.notify()
+			if isClosed(tk.future.done) {
+				return tk.future.res, true
+			}
+		}
+		if t.finished && t.unbound == 0 && len(t.order) == 0 {
+			return Result[In, Out]{}, false
+		}
+		changed := t.changed
+		t.mu.Unlock()
+		<-changed
+		t.mu.Lock()
+	}
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
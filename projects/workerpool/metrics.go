@@ -0,0 +1,276 @@
+package workerpool
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// durationBuckets are the upper bounds of the histogram buckets, from 1ms
+// to a minute; slower observations go into a final, unbounded bucket.
+var durationBuckets = []time.Duration{
+	time.Millisecond, 2500 * time.Microsecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second,
+	10 * time.Second, 30 * time.Second, time.Minute,
+}
+
+// histogram counts durations into durationBuckets with atomics, so workers
+// never wait for each other to record one.
+type histogram struct {
+	counts [16]atomic.Uint64 // len(durationBuckets) + 1
+	sum    atomic.Int64
+}
+
+func (h *histogram) observe(d time.Duration) {
+	i := 0
+	for i < len(durationBuckets) && d > durationBuckets[i] {
+		i++
+	}
+	h.counts[i].Add(1)
+	h.sum.Add(int64(d))
+}
+
+func (h *histogram) snapshot() Histogram {
+	s := Histogram{Bounds: durationBuckets, Counts: make([]uint64, len(h.counts))}
+	for i := range h.counts {
+		s.Counts[i] = h.counts[i].Load()
+		s.Count += s.Counts[i]
+	}
+	s.Sum = time.Duration(h.sum.Load())
+	return s
+}
+
+// Histogram is a snapshot of a distribution of durations. Counts[i] is the
+// number of observations in (Bounds[i-1], Bounds[i]]; the last count is of
+// those above every bound.
+type Histogram struct {
+	Bounds []time.Duration
+	Counts []uint64
+	Count  uint64
+	Sum    time.Duration
+}
+
+// Mean returns the average observation, or 0 without any.
+func (h Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// Quantile estimates the q-quantile, 0 <= q <= 1, as the upper bound of the
+// bucket it falls in. Observations above every bound report the last bound.
+func (h Histogram) Quantile(q float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := max(uint64(math.Ceil(q*float64(h.Count))), 1)
+	var seen uint64
+	for i, n := range h.Counts {
+		seen += n
+		if seen >= rank && i < len(h.Bounds) {
+			return h.Bounds[i]
+		}
+	}
+	return h.Bounds[len(h.Bounds)-1]
+}
+
+// counters are updated with atomics, like the autoscaler's measurements,
+// but never reset.
+type counters struct {
+	submitted atomic.Uint64
+	started   atomic.Uint64
+	succeeded atomic.Uint64
+	failed    atomic.Uint64
+	retried   atomic.Uint64
+	dropped   atomic.Uint64
+	busyTime  atomic.Int64 // nanoseconds workers spent on jobs, backoffs included
+
+	queueWait histogram
+	execTime  histogram // per attempt
+}
+
+// Metrics is a snapshot of a pool's counters since it was created.
+type Metrics struct {
+	Submitted uint64 // jobs accepted by Submit
+	Started   uint64 // jobs taken by a worker, including replayed ones
+	Succeeded uint64
+	Failed    uint64 // jobs that failed for good
+	Retried   uint64 // attempts that failed and were retried
+	Dropped   uint64 // jobs cut short by a forced stop
+
+	Workers     int // the size the pool is set to
+	Busy        int // workers running a job right now
+	QueueDepths []QueueDepth
+
+	QueueWait Histogram // time from Submit to a worker taking the job
+	ExecTime  Histogram // run time of every attempt
+
+	Uptime     time.Duration
+	BusyTime   time.Duration // time workers spent on jobs
+	WorkerTime time.Duration // time workers existed, summed over workers
+}
+
+// Throughput returns the average number of jobs finished per second since
+// the pool was created.
+func (m Metrics) Throughput() float64 {
+	if m.Uptime <= 0 {
+		return 0
+	}
+	return float64(m.Succeeded+m.Failed+m.Dropped) / m.Uptime.Seconds()
+}
+
+// Utilization returns the fraction of worker time spent on jobs since the
+// pool was created. Jobs still running are not counted until they finish.
+func (m Metrics) Utilization() float64 {
+	if m.WorkerTime <= 0 {
+		return 0
+	}
+	return math.Min(float64(m.BusyTime)/float64(m.WorkerTime), 1)
+}
+
+// Metrics returns a snapshot of the pool's counters. The counters are read
+// one by one, so a snapshot taken under load may be slightly inconsistent.
+func (p *Pool[In, Out]) Metrics() Metrics {
+	p.sizeMu.Lock()
+	p.accountWorkersLocked(time.Now())
+	workers, workerTime := p.target, p.workerTime
+	p.sizeMu.Unlock()
+
+	return Metrics{
+		Submitted:   p.stats.submitted.Load(),
+		Started:     p.stats.started.Load(),
+		Succeeded:   p.stats.succeeded.Load(),
+		Failed:      p.stats.failed.Load(),
+		Retried:     p.stats.retried.Load(),
+		Dropped:     p.stats.dropped.Load(),
+		Workers:     workers,
+		Busy:        int(p.busy.Load()),
+		QueueDepths: p.queue.Depths(),
+		QueueWait:   p.stats.queueWait.snapshot(),
+		ExecTime:    p.stats.execTime.snapshot(),
+		Uptime:      time.Since(p.created),
+		BusyTime:    time.Duration(p.stats.busyTime.Load()),
+		WorkerTime:  workerTime,
+	}
+}
+
+// accountWorkersLocked adds the worker time since the last change of the
+// worker count. It must be called with sizeMu held, before every change.
+func (p *Pool[In, Out]) accountWorkersLocked(now time.Time) {
+	p.workerTime += time.Duration(p.running) * now.Sub(p.sized)
+	p.sized = now
+}
+
+// WritePrometheus writes the snapshot as Prometheus text: the job counters,
+// gauges for the pool size and the depth of every queue, and the two
+// latency histograms. Metric names are namespace, an underscore and the
+// metric's own name, or just the latter when namespace is empty.
+func (m Metrics) WritePrometheus(w io.Writer, namespace string) error {
+	pw := promWriter{w: w}
+	if namespace != "" {
+		pw.prefix = namespace + "_"
+	}
+	counters := []struct {
+		name, help string
+		value      float64
+	}{
+		{"jobs_submitted_total", "Jobs accepted by Submit.", float64(m.Submitted)},
+		{"jobs_started_total", "Jobs taken by a worker.", float64(m.Started)},
+		{"jobs_succeeded_total", "Jobs that succeeded.", float64(m.Succeeded)},
+		{"jobs_failed_total", "Jobs that failed for good.", float64(m.Failed)},
+		{"jobs_retried_total", "Attempts that failed and were retried.", float64(m.Retried)},
+		{"jobs_dropped_total", "Jobs cut short by a forced stop.", float64(m.Dropped)},
+		{"busy_seconds_total", "Time workers spent on jobs.", m.BusyTime.Seconds()},
+		{"worker_seconds_total", "Time workers existed, summed over workers.", m.WorkerTime.Seconds()},
+	}
+	for _, c := range counters {
+		pw.header(c.name, c.help, "counter")
+		pw.sample(c.name, c.value)
+	}
+
+	pw.header("workers", "Workers the pool is sized for.", "gauge")
+	pw.sample("workers", float64(m.Workers))
+	pw.header("busy_workers", "Workers running a job.", "gauge")
+	pw.sample("busy_workers", float64(m.Busy))
+	pw.header("queue_depth", "Jobs waiting, by priority and tenant.", "gauge")
+	for _, d := range m.QueueDepths {
+		pw.sample("queue_depth", float64(d.Depth), "priority", d.Priority.String(), "tenant", d.Tenant)
+	}
+
+	pw.histogram("queue_wait_seconds", "Time jobs spent queued.", m.QueueWait)
+	pw.histogram("attempt_duration_seconds", "Run time of job attempts.", m.ExecTime)
+	return pw.err
+}
+
+// promWriter writes the exposition format, keeping the first error.
+type promWriter struct {
+	w      io.Writer
+	prefix string
+	err    error
+}
+
+func (pw *promWriter) header(name, help, kind string) {
+	name = pw.prefix + name
+	pw.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes one value; labels alternate between names and values.
+func (pw *promWriter) sample(name string, value float64, labels ...string) {
+	var b strings.Builder
+	b.WriteString(pw.prefix + name)
+	sep := "{"
+	for i := 0; i+1 < len(labels); i += 2 {
+		b.WriteString(sep + labels[i] + `="` + labelEscaper.Replace(labels[i+1]) + `"`)
+		sep = ","
+	}
+	if sep == "," {
+		b.WriteByte('}')
+	}
+	pw.printf("%s %g\n", b.String(), value)
+}
+
+// labelEscaper escapes a label value for the text format, which takes any
+// UTF-8 between the quotes except an unescaped backslash, double quote or
+// line feed. Go's %q would also escape non-ASCII and control characters in
+// a way Prometheus reads back literally.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (pw *promWriter) histogram(name, help string, h Histogram) {
+	pw.header(name, help, "histogram")
+	var cumulative uint64
+	for i, n := range h.Counts {
+		cumulative += n
+		le := "+Inf"
+		if i < len(h.Bounds) {
+			le = strconv.FormatFloat(h.Bounds[i].Seconds(), 'g', -1, 64)
+		}
+		pw.sample(name+"_bucket", float64(cumulative), "le", le)
+	}
+	pw.sample(name+"_sum", h.Sum.Seconds())
+	pw.sample(name+"_count", float64(h.Count))
+}
+
+func (pw *promWriter) printf(format string, args ...any) {
+	if pw.err == nil {
+		_, pw.err = fmt.Fprintf(pw.w, format, args...)
+	}
+}
+
+// PrometheusHandler returns a handler that writes metrics() on every
+// scrape, for example
+//
+//	http.Handle("/metrics", workerpool.PrometheusHandler("thumbnails", pool.Metrics))
+func PrometheusHandler(namespace string, metrics func() Metrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		metrics().WritePrometheus(w, namespace)
+	})
+}
@@ -0,0 +1,70 @@
+package workerpool
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	m := Metrics{
+		Submitted: 3,
+		Workers:   2,
+		QueueDepths: []QueueDepth{
+			{Priority: PriorityHigh, Tenant: "zürich", Depth: 1},
+			{Priority: PriorityLow, Tenant: "a\"b\\c\nd", Depth: 2},
+		},
+		QueueWait: Histogram{Bounds: []time.Duration{time.Millisecond}, Counts: []uint64{1, 1}, Count: 2, Sum: time.Second},
+	}
+
+	var b strings.Builder
+	if err := m.WritePrometheus(&b, "thumbs"); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, line := range []string{
+		"# HELP thumbs_jobs_submitted_total Jobs accepted by Submit.",
+		"# TYPE thumbs_jobs_submitted_total counter",
+		"thumbs_jobs_submitted_total 3",
+		"thumbs_workers 2",
+		`thumbs_queue_depth{priority="high",tenant="zürich"} 1`,
+		`thumbs_queue_depth{priority="low",tenant="a\"b\\c\nd"} 2`,
+		`thumbs_queue_wait_seconds_bucket{le="0.001"} 1`,
+		`thumbs_queue_wait_seconds_bucket{le="+Inf"} 2`,
+		"thumbs_queue_wait_seconds_sum 1",
+		"thumbs_queue_wait_seconds_count 2",
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, out)
+		}
+	}
+
+	b.Reset()
+	m.WritePrometheus(&b, "")
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		if strings.HasPrefix(line, "_") || strings.HasPrefix(line, "# HELP _") || strings.HasPrefix(line, "# TYPE _") {
+			t.Errorf("without a namespace a metric name starts with an underscore: %q", line)
+		}
+	}
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	p := New(func(ctx context.Context, n int) (int, error) { return n, nil }, WithoutResults())
+	f, err := p.Submit(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Wait(context.Background())
+	shutdown(t, p)
+
+	rec := httptest.NewRecorder()
+	PrometheusHandler("thumbs", p.Metrics).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if body := rec.Body.String(); !strings.Contains(body, "thumbs_jobs_succeeded_total 1\n") {
+		t.Errorf("missing thumbs_jobs_succeeded_total 1 in:\n%s", body)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q, want text/plain", ct)
+	}
+}
@@ -0,0 +1,134 @@
+package workerpool
+
+import (
+	"context"
+	"time"
+)
+
+// EventKind is a step in a job's life.
+type EventKind int
+
+const (
+	// EventQueued: Submit accepted the job. Submit reports it once the
+	// queue has assigned the job its ID, when a worker may already have
+	// taken the job, so for a fast job it can arrive after the job's
+	// other events.
+	EventQueued EventKind = iota
+	// EventStarted: a worker took the job off the queue. Wait is how long
+	// it was queued.
+	EventStarted
+	// EventSucceeded: the job's last attempt returned no error.
+	EventSucceeded
+	// EventFailed: the job failed for good.
+	EventFailed
+	// EventRetried: an attempt failed and the job runs again after
+	// Backoff.
+	EventRetried
+	// EventDropped: the pool was stopped before the job could finish. A
+	// durable queue keeps the job for the next start.
+	EventDropped
+	// EventQueueError: taking a job off the queue failed with Err. The
+	// worker tries again after Backoff, which doubles with every failure
+	// in a row up to a second. JobID is zero.
+	EventQueueError
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventQueued:
+		return "queued"
+	case EventStarted:
+		return "started"
+	case EventSucceeded:
+		return "succeeded"
+	case EventFailed:
+		return "failed"
+	case EventRetried:
+		return "retried"
+	case EventDropped:
+		return "dropped"
+	case EventQueueError:
+		return "queue error"
+	default:
+		return "unknown"
+	}
+}
+
+// Event describes one step in a job's life, for hooks registered with
+// WithHook. Fields that do not apply to the kind of event are zero.
+type Event struct {
+	Kind     EventKind
+	Time     time.Time
+	JobID    uint64
+	Priority Priority
+	Tenant   string
+
+	Attempt  int           // the attempt that ended; the number made so far for Succeeded, Failed and Dropped
+	Wait     time.Duration // time spent queued, for Started
+	Duration time.Duration // the attempt's run time for Retried; the job's for Succeeded, Failed and Dropped
+	Backoff  time.Duration // the wait before the next attempt, for Retried and QueueError
+	Err      error
+}
+
+// Attribute is a key-value pair attached to a span.
+type Attribute struct {
+	Key   string
+	Value any // string, int64, bool or float64
+}
+
+// Tracer starts spans. Its shape follows OpenTelemetry's, so wrapping a
+// trace.Tracer takes a few lines:
+//
+//	type otelTracer struct{ trace.Tracer }
+//
+//	func (t otelTracer) Start(ctx context.Context, name string, attrs ...workerpool.Attribute) (context.Context, workerpool.Span) {
+//		ctx, span := t.Tracer.Start(ctx, name, trace.WithAttributes(toKeyValues(attrs)...))
+//		return ctx, otelSpan{span}
+//	}
+//
+// The pool starts a "workerpool.job" span when a worker takes a job, and a
+// "workerpool.attempt" span inside it for every attempt. The handler's
+// context carries the attempt span, so spans the handler starts nest under
+// it. Job spans start from the pool's context, not Submit's, since the job
+// may be queued long after Submit returned or even by another process.
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	AddEvent(name string, attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// observe passes e to every hook.
+func (p *Pool[In, Out]) observe(e Event) {
+	if len(p.hooks) == 0 {
+		return
+	}
+	e.Time = time.Now()
+	for _, hook := range p.hooks {
+		hook(e)
+	}
+}
+
+// startSpan starts a span if the pool has a Tracer.
+func (p *Pool[In, Out]) startSpan(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	if p.tracer == nil {
+		return ctx, nil
+	}
+	return p.tracer.Start(ctx, name, attrs...)
+}
+
+// endSpan records err on span, if any, and ends it.
+func endSpan(span Span, err error) {
+	if span == nil {
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
@@ -0,0 +1,185 @@
+package workerpool
+
+import (
+	"runtime"
+	"time"
+)
+
+// Option configures a Pool at construction time.
+type Option func(*config)
+
+type config struct {
+	workers    int
+	queueSize  int
+	jobTimeout time.Duration
+	retry      RetryPolicy
+
+	tenantWeights map[string]int
+	autoscale     *AutoscalePolicy
+	queue         Queue
+
+	orderWindow    int
+	discardResults bool
+
+	hooks  []func(Event)
+	tracer Tracer
+}
+
+func defaultConfig() config {
+	return config{
+		workers:   runtime.NumCPU(),
+		queueSize: 10,
+	}
+}
+
+// WithWorkers sets the number of jobs that run concurrently. The default is
+// the number of CPUs.
+func WithWorkers(n int) Option {
+	return func(c *config) {
+		if n > 0 {
+			c.workers = n
+		}
+	}
+}
+
+// WithQueueSize sets how many submitted jobs may wait for a worker before
+// Submit blocks, and how many results may wait to be received. The default
+// is 10; at least one job can always wait. With WithQueue, the queue's own
+// Capacity applies to jobs instead.
+func WithQueueSize(n int) Option {
+	return func(c *config) {
+		if n >= 0 {
+			c.queueSize = n
+		}
+	}
+}
+
+// WithJobTimeout gives every job a deadline of d after it starts, unless
+// Submit is given a Timeout of its own. A job that runs past its deadline
+// fails with ErrJobTimeout. By default jobs have no deadline.
+func WithJobTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.jobTimeout = d
+	}
+}
+
+// WithRetry retries failed jobs according to policy. By default a job runs
+// once.
+func WithRetry(policy RetryPolicy) Option {
+	return func(c *config) {
+		c.retry = policy
+	}
+}
+
+// WithAutoscale lets the pool resize itself between policy.Min and
+// policy.Max workers as the load changes. WithWorkers then only sets the
+// initial size.
+func WithAutoscale(policy AutoscalePolicy) Option {
+	return func(c *config) {
+		c.autoscale = &policy
+	}
+}
+
+// WithTenantWeight gives tenant weight turns for every turn of a tenant of
+// weight 1 when jobs of the same priority compete for workers. The default
+// weight is 1. With WithQueue, configure the queue with TenantWeight
+// instead.
+func WithTenantWeight(tenant string, weight int) Option {
+	return func(c *config) {
+		if c.tenantWeights == nil {
+			c.tenantWeights = make(map[string]int)
+		}
+		c.tenantWeights[tenant] = weight
+	}
+}
+
+// WithQueue makes the pool keep its jobs in q instead of in memory, for
+// example in a durable queue from OpenFileQueue. The pool closes q when it
+// shuts down. Inputs that q hands back must be of the pool's input type.
+func WithQueue(q Queue) Option {
+	return func(c *config) {
+		c.queue = q
+	}
+}
+
+// WithOrderedResults delivers results on the Results channel in the order
+// the jobs were submitted instead of the order they finished. Results that
+// are ready early wait in a reorder buffer; at most window jobs may be
+// between Submit and the delivery of their result, and Submit blocks while
+// there are that many. A slow job, or a low-priority one, therefore holds
+// up the results behind it. Results of jobs replayed from a durable queue
+// are delivered as they finish.
+func WithOrderedResults(window int) Option {
+	return func(c *config) {
+		c.orderWindow = max(window, 1)
+	}
+}
+
+// WithoutResults delivers results to the jobs' futures only; nothing is
+// sent on the Results channel, which is still closed when the pool stops.
+// WithOrderedResults has no effect then.
+func WithoutResults() Option {
+	return func(c *config) {
+		c.discardResults = true
+	}
+}
+
+// WithHook calls hook at every step of every job's life; see EventKind.
+// Hooks run on the goroutine that took the step, a worker or the caller of
+// Submit, so they should return quickly, and the events of one job are
+// only ordered among those reported by the same goroutine: EventQueued
+// can come after the worker's events. WithHook may be given more than
+// once.
+func WithHook(hook func(Event)) Option {
+	return func(c *config) {
+		c.hooks = append(c.hooks, hook)
+	}
+}
+
+// WithTracer traces every job and every attempt with tracer.
+func WithTracer(tracer Tracer) Option {
+	return func(c *config) {
+		c.tracer = tracer
+	}
+}
+
+// JobOption configures a single job at Submit time.
+type JobOption func(*jobConfig)
+
+type jobConfig struct {
+	timeout  time.Duration
+	priority Priority
+	tenant   string
+	key      string
+}
+
+// Timeout sets the job's deadline, measured from when it starts, overriding
+// WithJobTimeout. Zero means no deadline.
+func Timeout(d time.Duration) JobOption {
+	return func(c *jobConfig) {
+		c.timeout = d
+	}
+}
+
+// AtPriority sets the job's priority. The default is PriorityNormal.
+func AtPriority(p Priority) JobOption {
+	return func(c *jobConfig) {
+		c.priority = p
+	}
+}
+
+// ForTenant attributes the job to tenant for fair scheduling. Jobs without a
+// tenant share the tenant "".
+func ForTenant(tenant string) JobOption {
+	return func(c *jobConfig) {
+		c.tenant = tenant
+	}
+}
+
+// IdempotencyKey identifies the job, so that submitting it again while it
+// is queued, or shortly after it is done, is a no-op; see Submit.
+func IdempotencyKey(key string) JobOption {
+	return func(c *jobConfig) {
+		c.key = key
+	}
+}
@@ -0,0 +1,586 @@
+// Question 1: Implementing a Worker Pool
+// Implement a worker pool in Go. The pool should receive jobs through
+// a channel, process each job concurrently, and send the results
+// back through another channel. Make sure to gracefully shut down the
+// workers when all jobs have been processed."
+
+// Package workerpool runs jobs on a fixed number of goroutines. A Pool is
+// generic over the job input and output, so the same pool works for any
+// handler:
+//
+//	p := workerpool.New(func(ctx context.Context, n int) (int, error) {
+//		return n * 2, nil
+//	}, workerpool.WithWorkers(3), workerpool.WithJobTimeout(time.Second))
+//	go func() {
+//		for res := range p.Results() {
+//			fmt.Println(res.JobID, res.Output, res.Err)
+//		}
+//	}()
+//	p.Submit(ctx, 21)
+//	p.Shutdown(ctx)
+//
+// Every submitted job produces exactly one Result, including jobs that time
+// out or are cancelled by a forced stop.
+//
+// Jobs wait in a Queue, in memory by default. With WithQueue and
+// OpenFileQueue they are kept on disk instead, and jobs that had not
+// finished when the process stopped run again when a new pool opens the
+// same queue.
+//
+// WithHook, Metrics and WithTracer show what the pool is doing: every step
+// of a job's life, how long jobs wait and run, and how busy the workers are.
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrClosed is returned by Submit after Shutdown.
+var ErrClosed = errors.New("workerpool: pool is shut down")
+
+// ErrPanic wraps the value of a handler that panicked.
+var ErrPanic = errors.New("workerpool: handler panicked")
+
+// ErrJobTimeout is the error of a job that ran past its deadline. It also
+// matches context.DeadlineExceeded.
+var ErrJobTimeout = errors.New("workerpool: job timed out")
+
+// ErrStopped is the error of a job that was cancelled, or never started,
+// because the pool was stopped. It also matches the pool context's error.
+var ErrStopped = errors.New("workerpool: pool stopped")
+
+// Handler processes one job.
+type Handler[In, Out any] func(ctx context.Context, in In) (Out, error)
+
+// Result is the outcome of one job. Err is the error of the last attempt;
+// Output is only meaningful when Err is nil.
+type Result[In, Out any] struct {
+	JobID    uint64
+	Input    In
+	Output   Out
+	Err      error
+	Attempts []Attempt
+}
+
+type job[In any] struct {
+	id      uint64
+	in      In
+	timeout time.Duration
+}
+
+// Pool runs submitted jobs on a fixed set of workers and delivers their
+// results on the Results channel.
+type Pool[In, Out any] struct {
+	handler    Handler[In, Out]
+	jobTimeout time.Duration
+	retry      RetryPolicy
+	deadLetter atomic.Pointer[func(DeadLetter[In])]
+	queue      Queue
+	results    chan Result[In, Out]
+	discard    bool // results only go to futures
+	track      *tracker[In, Out]
+	workers    sync.WaitGroup
+	hooks      []func(Event)
+	tracer     Tracer
+	stats      counters
+	created    time.Time
+
+	// sizeMu guards the worker count. Workers above target retire after
+	// their current job; stopped is set once the queue is closed. Idle
+	// workers wait in Dequeue with wake, which Resize cancels so they
+	// check whether to retire.
+	sizeMu  sync.Mutex
+	target  int
+	running int
+	stopped bool
+	wake    context.Context
+	wakeUp  context.CancelFunc
+
+	// workerTime is the worker time up to sized, when the worker count
+	// last changed.
+	workerTime time.Duration
+	sized      time.Time
+
+	// Load measurements for the autoscaler, reset on every evaluation.
+	busy    atomic.Int64 // workers running a job
+	waitSum atomic.Int64 // nanoseconds jobs spent queued
+	execSum atomic.Int64 // nanoseconds workers spent on jobs
+	started atomic.Int64 // jobs taken off the queue
+
+	shutdown sync.Once
+	emitted  chan struct{} // closed once every result has been sent
+	drained  chan struct{} // closed once the workers have exited
+
+	// ctx is the parent of every job's context; cancelling it is a forced
+	// stop.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// New starts a pool that runs handler for every submitted job.
+func New[In, Out any](handler Handler[In, Out], opts ...Option) *Pool[In, Out] {
+	return NewWithContext(context.Background(), handler, opts...)
+}
+
+// NewWithContext is like New, but cancelling ctx stops the pool as if a
+// Shutdown had run out of time: running jobs are cancelled, queued jobs fail
+// with ErrStopped and Results is closed.
+func NewWithContext[In, Out any](ctx context.Context, handler Handler[In, Out], opts ...Option) *Pool[In, Out] {
+	cfg := defaultConfig()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if cfg.queue == nil {
+		queueOpts := []QueueOption{Capacity(cfg.queueSize)}
+		for tenant, weight := range cfg.tenantWeights {
+			queueOpts = append(queueOpts, TenantWeight(tenant, weight))
+		}
+		cfg.queue = NewMemoryQueue(queueOpts...)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	p := &Pool[In, Out]{
+		handler:    handler,
+		jobTimeout: cfg.jobTimeout,
+		retry:      cfg.retry.withDefaults(),
+		queue:      cfg.queue,
+		results:    make(chan Result[In, Out], cfg.queueSize),
+		discard:    cfg.discardResults,
+		track:      newTracker[In, Out](cfg.orderWindow > 0 && !cfg.discardResults, cfg.orderWindow),
+		hooks:      cfg.hooks,
+		tracer:     cfg.tracer,
+		created:    time.Now(),
+		emitted:    make(chan struct{}),
+		drained:    make(chan struct{}),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+	p.sized = p.created
+	workers := cfg.workers
+	if cfg.autoscale != nil {
+		workers = min(max(workers, cfg.autoscale.Min), cfg.autoscale.Max)
+		go p.autoscale(cfg.autoscale.withDefaults())
+	}
+	p.Resize(workers)
+	if p.track.ordered {
+		go p.emit()
+	} else {
+		close(p.emitted)
+	}
+	go func() {
+		<-ctx.Done()
+		p.closeQueue()
+	}()
+	return p
+}
+
+// Resize changes the number of workers to n, which must be at least 1.
+// New workers start at once; surplus workers finish the job they are
+// running, if any, before they exit, so no job is lost. Resize has no
+// effect once the pool is shutting down.
+func (p *Pool[In, Out]) Resize(n int) {
+	n = max(n, 1)
+	p.sizeMu.Lock()
+	if p.stopped {
+		p.sizeMu.Unlock()
+		return
+	}
+	p.target = n
+	p.accountWorkersLocked(time.Now())
+	for ; p.running < p.target; p.running++ {
+		p.workers.Add(1)
+		go p.worker()
+	}
+	// Let idle surplus workers notice.
+	if p.wakeUp != nil {
+		p.wakeUp()
+	}
+	// Not derived from p.ctx: after a forced stop, workers still drain the
+	// queue so that every job gets its Result.
+	p.wake, p.wakeUp = context.WithCancel(context.Background())
+	p.sizeMu.Unlock()
+}
+
+// Workers returns the number of workers the pool is sized for. While the
+// pool shrinks, workers still finishing a job are not counted.
+func (p *Pool[In, Out]) Workers() int {
+	p.sizeMu.Lock()
+	defer p.sizeMu.Unlock()
+	return p.target
+}
+
+// retire reports whether the calling worker should exit because the pool
+// has more workers than it is sized for, and if so counts it out. It also
+// returns the context to wait for the next job with.
+func (p *Pool[In, Out]) retire() (bool, context.Context) {
+	p.sizeMu.Lock()
+	defer p.sizeMu.Unlock()
+	if p.running > p.target {
+		p.accountWorkersLocked(time.Now())
+		p.running--
+		return true, nil
+	}
+	return false, p.wake
+}
+
+// exit counts out a worker leaving because the queue is closed.
+func (p *Pool[In, Out]) exit() {
+	p.sizeMu.Lock()
+	defer p.sizeMu.Unlock()
+	p.accountWorkersLocked(time.Now())
+	p.running--
+}
+
+// Submit queues a job and returns a Future for its Result. The job's ID is
+// repeated in the Result. Submit blocks while the queue is full, or, with
+// WithOrderedResults, while the reorder window is, until ctx is done. Jobs
+// run by priority and, within a priority, fairly across tenants; see
+// AtPriority and ForTenant.
+//
+// If the job has the IdempotencyKey of a job that is already queued or
+// recently done, Submit returns ErrDuplicate, and only the earlier job
+// produces a Result. The returned Future is then the earlier job's, or nil
+// if that job is done or was not submitted to this pool.
+func (p *Pool[In, Out]) Submit(ctx context.Context, in In, opts ...JobOption) (*Future[In, Out], error) {
+	cfg := jobConfig{timeout: p.jobTimeout, priority: PriorityNormal}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(p.ctx, cancel)
+	defer stop()
+
+	tk, err := p.track.reserve(ctx)
+	if err != nil {
+		if p.ctx.Err() != nil {
+			return nil, ErrClosed
+		}
+		return nil, err
+	}
+	id, err := p.queue.Enqueue(ctx, Message{
+		Payload:  in,
+		Priority: cfg.priority,
+		Tenant:   cfg.tenant,
+		Key:      cfg.key,
+		Timeout:  cfg.timeout,
+	})
+	earlier := p.track.bind(tk, id, err)
+	switch {
+	case errors.Is(err, ErrDuplicate):
+		return earlier, err
+	case errors.Is(err, ErrQueueClosed) || (err != nil && p.ctx.Err() != nil):
+		return nil, ErrClosed
+	case err != nil:
+		return nil, err
+	}
+	p.stats.submitted.Add(1)
+	p.observe(Event{Kind: EventQueued, JobID: id, Priority: cfg.priority, Tenant: cfg.tenant})
+	return tk.future, nil
+}
+
+// QueueDepths returns how many jobs are waiting, per priority and tenant,
+// highest priority first. Tenants without waiting jobs are left out.
+func (p *Pool[In, Out]) QueueDepths() []QueueDepth {
+	return p.queue.Depths()
+}
+
+// Results returns the channel on which the result of every job is
+// delivered, in completion order unless WithOrderedResults is given. It is
+// closed once the pool has stopped and all jobs are done. Results must be
+// received, or the workers stall once the channel's buffer is full; pools
+// whose callers only wait on futures should use WithoutResults.
+func (p *Pool[In, Out]) Results() <-chan Result[In, Out] {
+	return p.results
+}
+
+// Shutdown stops accepting jobs and waits until every queued job has been
+// processed, then closes Results and returns nil. If ctx is done first, it
+// forces a stop instead: running jobs are cancelled, queued jobs fail with
+// ErrStopped, and Shutdown returns ctx's error once the workers have exited.
+// A durable queue keeps the jobs that failed with ErrStopped, so they run
+// again after a restart. It is safe to call more than once.
+func (p *Pool[In, Out]) Shutdown(ctx context.Context) error {
+	p.closeQueue()
+	select {
+	case <-p.drained:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		<-p.drained
+		return ctx.Err()
+	}
+}
+
+// closeQueue stops accepting jobs. The workers finish the queued ones and
+// exit; the last one out closes Results.
+func (p *Pool[In, Out]) closeQueue() {
+	p.shutdown.Do(func() {
+		p.sizeMu.Lock()
+		p.stopped = true
+		p.sizeMu.Unlock()
+		p.queue.Close()
+
+		go func() {
+			p.workers.Wait()
+			p.track.finish()
+			<-p.emitted
+			close(p.results)
+			close(p.drained)
+		}()
+	})
+}
+
+func (p *Pool[In, Out]) worker() {
+	defer p.workers.Done()
+	failures := 0
+	for {
+		retired, wake := p.retire()
+		if retired {
+			return
+		}
+		m, err := p.queue.Dequeue(wake)
+		if errors.Is(err, ErrQueueClosed) {
+			p.exit()
+			return
+		}
+		if err != nil && wake.Err() != nil {
+			// Woken by Resize; check whether to retire.
+			continue
+		}
+		if err != nil {
+			failures++
+			p.backOff(wake, err, failures)
+			continue
+		}
+		failures = 0
+
+		start := time.Now()
+		wait := start.Sub(m.EnqueuedAt)
+		p.busy.Add(1)
+		p.started.Add(1)
+		p.waitSum.Add(int64(wait))
+		p.stats.started.Add(1)
+		p.stats.queueWait.observe(wait)
+		p.observe(Event{Kind: EventStarted, JobID: m.ID, Priority: m.Priority, Tenant: m.Tenant, Wait: wait})
+
+		ctx, span := p.startSpan(p.ctx, "workerpool.job",
+			Attribute{"job.id", int64(m.ID)},
+			Attribute{"job.priority", m.Priority.String()},
+			Attribute{"job.tenant", m.Tenant},
+			Attribute{"job.deliveries", int64(m.Deliveries)},
+			Attribute{"job.queue_wait_ms", float64(wait) / float64(time.Millisecond)})
+		release := p.hold(m)
+		res := p.process(ctx, m)
+		release()
+		elapsed := time.Since(start)
+		endSpan(span, res.Err)
+		p.execSum.Add(int64(elapsed))
+		p.stats.busyTime.Add(int64(elapsed))
+		p.busy.Add(-1)
+
+		// A job cut short by a stop stays queued: a durable queue runs it
+		// again after a restart. The pool's context may have been cancelled
+		// by its parent, so make sure the queue is closed first; an open
+		// queue would hand the job straight back out.
+		if errors.Is(res.Err, ErrStopped) {
+			p.closeQueue()
+			err = p.queue.Nack(m.ID)
+		} else {
+			err = p.queue.Ack(m.ID)
+		}
+		if errors.Is(err, ErrUnknownMessage) {
+			// The job was delivered again and another delivery has
+			// settled it, or will; that one produces the Result.
+			continue
+		}
+		p.finished(m, res, elapsed)
+		p.track.complete(res)
+		if !p.track.ordered && !p.discard {
+			p.results <- res
+		}
+		if sink := p.deadLetter.Load(); sink != nil && res.Err != nil && !errors.Is(res.Err, ErrStopped) {
+			(*sink)(DeadLetter[In]{JobID: res.JobID, Input: res.Input, Attempts: res.Attempts, Err: res.Err})
+		}
+	}
+}
+
+// backOff waits after the queue failed failures times in a row, so a
+// broken queue does not keep the worker spinning. Resize and a forced stop
+// cut the wait short.
+func (p *Pool[In, Out]) backOff(wake context.Context, err error, failures int) {
+	d := min(10*time.Millisecond<<min(failures-1, 7), time.Second)
+	p.observe(Event{Kind: EventQueueError, Backoff: d, Err: err})
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-wake.Done():
+	case <-p.ctx.Done():
+	}
+}
+
+// hold keeps m in flight while a worker runs it, extending its visibility
+// timeout halfway through every period so the queue does not deliver it to
+// another worker meanwhile. The returned function stops extending.
+func (p *Pool[In, Out]) hold(m Message) (release func()) {
+	if m.RedeliverAt.IsZero() {
+		return func() {}
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		deadline := m.RedeliverAt
+		for {
+			timer := time.NewTimer(time.Until(deadline) / 2)
+			select {
+			case <-done:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			var err error
+			if deadline, err = p.queue.Extend(m.ID); err != nil {
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// emit sends results on in submission order, in ordered mode.
+func (p *Pool[In, Out]) emit() {
+	defer close(p.emitted)
+	for {
+		res, ok := p.track.next()
+		if !ok {
+			return
+		}
+		p.results <- res
+	}
+}
+
+// finished counts a job's outcome and reports it to the hooks.
+func (p *Pool[In, Out]) finished(m Message, res Result[In, Out], elapsed time.Duration) {
+	e := Event{JobID: m.ID, Priority: m.Priority, Tenant: m.Tenant, Attempt: len(res.Attempts), Duration: elapsed, Err: res.Err}
+	switch {
+	case res.Err == nil:
+		p.stats.succeeded.Add(1)
+		e.Kind = EventSucceeded
+	case errors.Is(res.Err, ErrStopped):
+		p.stats.dropped.Add(1)
+		e.Kind = EventDropped
+	default:
+		p.stats.failed.Add(1)
+		e.Kind = EventFailed
+	}
+	p.observe(e)
+}
+
+// process runs a job until it succeeds, fails for good or the pool stops.
+// ctx carries the job's span.
+func (p *Pool[In, Out]) process(ctx context.Context, m Message) Result[In, Out] {
+	res := Result[In, Out]{JobID: m.ID}
+	in, ok := m.Payload.(In)
+	if !ok {
+		res.Err = Permanent(fmt.Errorf("workerpool: job %d has input of type %T", m.ID, m.Payload))
+		return res
+	}
+	res.Input = in
+	j := job[In]{id: m.ID, in: in, timeout: m.Timeout}
+	for attempt := 1; ; attempt++ {
+		if err := p.ctx.Err(); err != nil {
+			res.Err = fmt.Errorf("%w: %w", ErrStopped, err)
+			return res
+		}
+
+		attemptCtx, span := p.startSpan(ctx, "workerpool.attempt", Attribute{"job.attempt", int64(attempt)})
+		start := time.Now()
+		out, err := p.run(attemptCtx, j)
+		duration := time.Since(start)
+		endSpan(span, err)
+		p.stats.execTime.observe(duration)
+		res.Attempts = append(res.Attempts, Attempt{Number: attempt, Start: start, Duration: duration, Err: err})
+		res.Output, res.Err = out, err
+		if err == nil || attempt >= p.retry.MaxAttempts || !p.retry.retryable(err) {
+			return res
+		}
+
+		delay := p.retry.backoff(attempt)
+		p.stats.retried.Add(1)
+		p.observe(Event{
+			Kind: EventRetried, JobID: m.ID, Priority: m.Priority, Tenant: m.Tenant,
+			Attempt: attempt, Duration: duration, Backoff: delay, Err: err,
+		})
+		backoff := time.NewTimer(delay)
+		select {
+		case <-backoff.C:
+		case <-p.ctx.Done():
+			backoff.Stop()
+		}
+	}
+}
+
+// run calls the handler with the job's context, derived from ctx. If the
+// context ends first the worker gives up on the job and moves on; a handler
+// that ignores its context keeps running in the background, but no longer
+// holds a worker.
+func (p *Pool[In, Out]) run(ctx context.Context, j job[In]) (Out, error) {
+	cancel := context.CancelFunc(func() {})
+	if j.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, j.timeout)
+	}
+	defer cancel()
+
+	type outcome struct {
+		out Out
+		err error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		out, err := p.call(ctx, j.in)
+		done <- outcome{out, err}
+	}()
+
+	select {
+	case o := <-done:
+		if o.err != nil && ctx.Err() != nil {
+			// The handler gave up because of its context; report why.
+			return o.out, p.contextError(ctx, j.timeout)
+		}
+		return o.out, o.err
+	case <-ctx.Done():
+		var zero Out
+		return zero, p.contextError(ctx, j.timeout)
+	}
+}
+
+func (p *Pool[In, Out]) contextError(ctx context.Context, timeout time.Duration) error {
+	if err := p.ctx.Err(); err != nil {
+		return fmt.Errorf("%w: %w", ErrStopped, err)
+	}
+	return fmt.Errorf("%w after %v: %w", ErrJobTimeout, timeout, ctx.Err())
+}
+
+// call runs the handler, turning a panic into an error so one bad job
+// cannot take the whole pool down.
+func (p *Pool[In, Out]) call(ctx context.Context, in In) (out Out, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrPanic, r)
+		}
+	}()
+	return p.handler(ctx, in)
+}
@@ -0,0 +1,258 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collect receives every Result until the pool closes Results.
+func collect[In, Out any](p *Pool[In, Out]) <-chan []Result[In, Out] {
+	all := make(chan []Result[In, Out], 1)
+	go func() {
+		var results []Result[In, Out]
+		for res := range p.Results() {
+			results = append(results, res)
+		}
+		all <- results
+	}()
+	return all
+}
+
+func shutdown[In, Out any](t *testing.T, p *Pool[In, Out]) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+}
+
+func submit[In, Out any](t *testing.T, p *Pool[In, Out], in In, opts ...JobOption) *Future[In, Out] {
+	t.Helper()
+	f, err := p.Submit(context.Background(), in, opts...)
+	if err != nil {
+		t.Fatalf("Submit(%v): %v", in, err)
+	}
+	return f
+}
+
+// blocking is a handler that runs until its context is done.
+func blocking(ctx context.Context, n int) (int, error) {
+	<-ctx.Done()
+	return 0, ctx.Err()
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	p := New(func(ctx context.Context, n int) (int, error) {
+		time.Sleep(5 * time.Millisecond)
+		return n * n, nil
+	}, WithWorkers(2))
+	results := collect(p)
+	for i := 0; i < 10; i++ {
+		submit(t, p, i)
+	}
+	shutdown(t, p)
+
+	got := <-results
+	if len(got) != 10 {
+		t.Fatalf("%d Results after a graceful Shutdown, want all 10", len(got))
+	}
+	for _, res := range got {
+		if res.Err != nil || res.Output != res.Input*res.Input {
+			t.Errorf("job %d: Output %d, Err %v", res.Input, res.Output, res.Err)
+		}
+	}
+	if _, err := p.Submit(context.Background(), 1); !errors.Is(err, ErrClosed) {
+		t.Errorf("Submit after Shutdown: %v, want ErrClosed", err)
+	}
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Errorf("second Shutdown: %v", err)
+	}
+}
+
+func TestForcedShutdown(t *testing.T) {
+	p := New(blocking, WithWorkers(1))
+	results := collect(p)
+	for i := 0; i < 3; i++ {
+		submit(t, p, i)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown = %v, want the context's error", err)
+	}
+
+	// The running job is cancelled and the queued ones never start, but
+	// every job still gets a Result.
+	got := <-results
+	if len(got) != 3 {
+		t.Fatalf("%d Results after a forced stop, want 3", len(got))
+	}
+	for _, res := range got {
+		if !errors.Is(res.Err, ErrStopped) {
+			t.Errorf("job %d: Err %v, want ErrStopped", res.Input, res.Err)
+		}
+	}
+	if m := p.Metrics(); m.Dropped != 3 || m.Started != 3 {
+		t.Errorf("Metrics: Dropped %d, Started %d; want 3 and 3", m.Dropped, m.Started)
+	}
+}
+
+func TestJobTimeout(t *testing.T) {
+	p := New(func(ctx context.Context, d time.Duration) (time.Duration, error) {
+		time.Sleep(d) // ignores ctx; the worker must not wait for it
+		return d, nil
+	}, WithJobTimeout(20*time.Millisecond), WithoutResults())
+	defer shutdown(t, p)
+
+	start := time.Now()
+	res, _ := submit(t, p, time.Second).Wait(context.Background())
+	if !errors.Is(res.Err, ErrJobTimeout) || !errors.Is(res.Err, context.DeadlineExceeded) {
+		t.Errorf("Err = %v, want ErrJobTimeout wrapping context.DeadlineExceeded", res.Err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("a job with a 20ms timeout held the worker for %v", elapsed)
+	}
+
+	// Timeout overrides WithJobTimeout for one job.
+	res, _ = submit(t, p, 40*time.Millisecond, Timeout(time.Second)).Wait(context.Background())
+	if res.Err != nil {
+		t.Errorf("a job within its own timeout failed: %v", res.Err)
+	}
+	res, _ = submit(t, p, 40*time.Millisecond, Timeout(10*time.Millisecond)).Wait(context.Background())
+	if !errors.Is(res.Err, ErrJobTimeout) {
+		t.Errorf("Err = %v, want ErrJobTimeout", res.Err)
+	}
+}
+
+func TestRetriesEndInDeadLetter(t *testing.T) {
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	p := New(func(ctx context.Context, in string) (string, error) {
+		mu.Lock()
+		calls[in]++
+		n := calls[in]
+		mu.Unlock()
+		switch {
+		case in == "permanent":
+			return "", Permanent(errors.New("bad input"))
+		case in == "flaky" && n == 2:
+			return "ok", nil
+		}
+		return "", fmt.Errorf("attempt %d failed", n)
+	}, WithRetry(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}), WithoutResults())
+	var dead []DeadLetter[string]
+	p.OnDeadLetter(func(dl DeadLetter[string]) {
+		mu.Lock()
+		defer mu.Unlock()
+		dead = append(dead, dl)
+	})
+
+	attempts := make(map[string]int)
+	for _, in := range []string{"failing", "flaky", "permanent"} {
+		res, _ := submit(t, p, in).Wait(context.Background())
+		attempts[in] = len(res.Attempts)
+	}
+	shutdown(t, p)
+
+	if fmt.Sprint(attempts) != "map[failing:3 flaky:2 permanent:1]" {
+		t.Errorf("attempts per job %v, want failing:3 flaky:2 permanent:1", attempts)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(dead) != 2 || dead[0].Input != "failing" || dead[1].Input != "permanent" {
+		t.Fatalf("dead letters %+v, want failing and permanent", dead)
+	}
+	if dl := dead[0]; len(dl.Attempts) != 3 || dl.Err == nil || dl.Err.Error() != "attempt 3 failed" {
+		t.Errorf("dead letter for failing: %d attempts, Err %v; want 3 and the last error", len(dl.Attempts), dl.Err)
+	}
+	if m := p.Metrics(); m.Retried != 3 || m.Failed != 2 || m.Succeeded != 1 {
+		t.Errorf("Metrics: Retried %d, Failed %d, Succeeded %d; want 3, 2, 1", m.Retried, m.Failed, m.Succeeded)
+	}
+}
+
+func TestResizeShrinkKeepsJobs(t *testing.T) {
+	p := New(func(ctx context.Context, n int) (int, error) {
+		time.Sleep(5 * time.Millisecond)
+		return n, nil
+	}, WithWorkers(8))
+	results := collect(p)
+	for i := 0; i < 50; i++ {
+		submit(t, p, i)
+		if i == 20 {
+			p.Resize(1)
+		}
+	}
+	if n := p.Workers(); n != 1 {
+		t.Errorf("Workers = %d after Resize(1)", n)
+	}
+	shutdown(t, p)
+
+	seen := make(map[int]bool)
+	for _, res := range <-results {
+		if res.Err != nil {
+			t.Errorf("job %d: %v", res.Input, res.Err)
+		}
+		seen[res.Input] = true
+	}
+	if len(seen) != 50 {
+		t.Errorf("%d of 50 jobs produced a Result after shrinking", len(seen))
+	}
+}
+
+func TestOrderedResults(t *testing.T) {
+	// Later jobs finish first.
+	p := New(func(ctx context.Context, n int) (int, error) {
+		time.Sleep(time.Duration(10-n) * 3 * time.Millisecond)
+		return n, nil
+	}, WithWorkers(4), WithOrderedResults(4))
+	results := collect(p)
+	futures := make([]*Future[int, int], 10)
+	for i := range futures {
+		futures[i] = submit(t, p, i)
+	}
+
+	for i, f := range futures {
+		res, err := f.Wait(context.Background())
+		if err != nil || res.Output != i || res.JobID != f.ID() {
+			t.Errorf("Wait for job %d = %+v, %v", i, res, err)
+		}
+	}
+	shutdown(t, p)
+
+	var order []int
+	for _, res := range <-results {
+		order = append(order, res.Input)
+	}
+	if fmt.Sprint(order) != "[0 1 2 3 4 5 6 7 8 9]" {
+		t.Errorf("Results in order %v, want submission order", order)
+	}
+}
+
+func TestFutureWaitGivesUp(t *testing.T) {
+	p := New(blocking, WithoutResults())
+	f := submit(t, p, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := f.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait = %v, want the context's error", err)
+	}
+	select {
+	case <-f.Done():
+		t.Error("the job finished when Wait gave up")
+	default:
+	}
+
+	stop, cancel := context.WithCancel(context.Background())
+	cancel()
+	p.Shutdown(stop)
+	if res, err := f.Wait(context.Background()); err != nil || !errors.Is(res.Err, ErrStopped) {
+		t.Errorf("Wait after a forced stop = %v, %v; want a Result with ErrStopped", res.Err, err)
+	}
+}
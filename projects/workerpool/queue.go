@@ -0,0 +1,387 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrQueueClosed is returned by Enqueue after Close, and by Dequeue once
+// the queue is closed and no message is waiting.
+var ErrQueueClosed = errors.New("workerpool: queue is closed")
+
+// ErrDuplicate is returned by Enqueue, together with the ID of the earlier
+// message, when a message with the same idempotency key is waiting, in
+// flight or was acknowledged within the key retention period.
+var ErrDuplicate = errors.New("workerpool: duplicate idempotency key")
+
+// ErrUnknownMessage is returned by Ack, Nack and Extend for a message that
+// is not in flight, for example because its visibility timeout expired and
+// it was delivered again.
+var ErrUnknownMessage = errors.New("workerpool: unknown message")
+
+// Message is a job as stored in a Queue.
+type Message struct {
+	ID         uint64 // assigned by Enqueue
+	Payload    any    // the job input
+	Priority   Priority
+	Tenant     string
+	Key        string        // idempotency key, optional
+	Timeout    time.Duration // the job's deadline, 0 for none
+	EnqueuedAt time.Time
+	Deliveries int // how often the message has been dequeued, including this time
+
+	// RedeliverAt is when the message is delivered again unless it is
+	// acknowledged or extended first; zero without a visibility timeout.
+	RedeliverAt time.Time
+}
+
+// Queue holds the jobs of a Pool between Submit and the workers. Delivery
+// is at-least-once: a dequeued message stays in flight until it is
+// acknowledged, and is delivered again if it is negatively acknowledged, if
+// its visibility timeout expires or, for a durable queue, if the process
+// restarts first. Handlers must therefore tolerate running a job twice;
+// idempotency keys only stop the same job from being enqueued twice.
+//
+// A Pool extends the visibility timeout of the messages its workers are
+// running, and only the worker whose Ack or Nack succeeds delivers the
+// job's Result, so a job delivered twice still produces one Result.
+//
+// NewMemoryQueue and OpenFileQueue provide the built-in implementations;
+// both order messages by priority and fairly across tenants.
+type Queue interface {
+	// Enqueue adds m, waiting while the queue is full, and returns the ID
+	// it assigned.
+	Enqueue(ctx context.Context, m Message) (uint64, error)
+	// Dequeue waits for the next message and puts it in flight.
+	Dequeue(ctx context.Context) (Message, error)
+	// Ack removes a message in flight for good.
+	Ack(id uint64) error
+	// Extend restarts the visibility timeout of a message in flight and
+	// returns its new RedeliverAt.
+	Extend(id uint64) (time.Time, error)
+	// Nack returns a message in flight to the queue. After Close it stays
+	// out of Dequeue's reach; a durable queue delivers it after a restart.
+	Nack(id uint64) error
+	// Depths returns the number of waiting messages per priority and
+	// tenant.
+	Depths() []QueueDepth
+	// Close stops accepting messages. Dequeue keeps returning the waiting
+	// ones, then fails with ErrQueueClosed; Ack and Nack keep working.
+	Close() error
+}
+
+// QueueOption configures a built-in Queue.
+type QueueOption func(*queueConfig)
+
+type queueConfig struct {
+	capacity     int
+	weights      map[string]int
+	visibility   time.Duration
+	keyRetention time.Duration
+	segmentSize  int64
+	noSync       bool
+}
+
+func defaultQueueConfig() queueConfig {
+	return queueConfig{
+		capacity:     10,
+		keyRetention: time.Hour,
+		segmentSize:  4 << 20,
+	}
+}
+
+// Capacity sets how many messages may wait before Enqueue blocks. The
+// default is 10; messages loaded from disk or delivered again do not count
+// against it.
+func Capacity(n int) QueueOption {
+	return func(c *queueConfig) {
+		c.capacity = n
+	}
+}
+
+// TenantWeight is the queue's counterpart of WithTenantWeight.
+func TenantWeight(tenant string, weight int) QueueOption {
+	return func(c *queueConfig) {
+		if c.weights == nil {
+			c.weights = make(map[string]int)
+		}
+		c.weights[tenant] = weight
+	}
+}
+
+// VisibilityTimeout delivers a message again if it has been in flight for d
+// without being acknowledged or extended, for example because a consumer
+// other than a Pool dequeued it and went away. A Pool keeps extending the
+// messages its workers are running; use WithJobTimeout for stuck handlers.
+// By default messages stay in flight until they are acknowledged.
+func VisibilityTimeout(d time.Duration) QueueOption {
+	return func(c *queueConfig) {
+		c.visibility = d
+	}
+}
+
+// KeyRetention sets how long the idempotency key of an acknowledged message
+// keeps rejecting duplicates. The default is an hour.
+func KeyRetention(d time.Duration) QueueOption {
+	return func(c *queueConfig) {
+		c.keyRetention = d
+	}
+}
+
+// inflight is a message that has been dequeued but not acknowledged.
+type inflight struct {
+	msg      Message
+	deadline time.Time // zero without a visibility timeout
+}
+
+// ackedKey remembers the idempotency key of an acknowledged message. A
+// FileQueue logs it, so duplicates are still caught after a restart.
+type ackedKey struct {
+	Key string    `json:"key"`
+	ID  uint64    `json:"id"`
+	At  time.Time `json:"at"`
+}
+
+// messageQueue implements Queue on top of the scheduler. A FileQueue adds a
+// log to it; the in-memory queue has none.
+type messageQueue struct {
+	sched *scheduler
+	cfg   queueConfig
+	log   *segmentLog // nil for the in-memory queue
+
+	mu        sync.Mutex
+	nextID    uint64
+	dequeuing int // Dequeue calls between pop and registering in flight
+	inflight  map[uint64]*inflight
+	keys      map[string]uint64 // idempotency key -> message ID
+	acked     []ackedKey        // in acknowledgement order, for expiry
+	closed    bool
+	stop      chan struct{} // stops the visibility reaper
+}
+
+// NewMemoryQueue returns a Queue that lives in memory only. It is what a
+// Pool uses unless WithQueue says otherwise.
+func NewMemoryQueue(opts ...QueueOption) Queue {
+	cfg := defaultQueueConfig()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return newMessageQueue(cfg, nil)
+}
+
+func newMessageQueue(cfg queueConfig, log *segmentLog) *messageQueue {
+	q := &messageQueue{
+		sched:    newScheduler(cfg.capacity, cfg.weights),
+		cfg:      cfg,
+		log:      log,
+		inflight: make(map[uint64]*inflight),
+		keys:     make(map[string]uint64),
+		stop:     make(chan struct{}),
+	}
+	if cfg.visibility > 0 {
+		go q.reap()
+	}
+	return q
+}
+
+func (q *messageQueue) Enqueue(ctx context.Context, m Message) (uint64, error) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return 0, ErrQueueClosed
+	}
+	q.expireKeys(time.Now())
+	if m.Key != "" {
+		if id, ok := q.keys[m.Key]; ok {
+			q.mu.Unlock()
+			return id, ErrDuplicate
+		}
+	}
+	q.nextID++
+	m.ID = q.nextID
+	m.EnqueuedAt = time.Now()
+	m.Deliveries = 0
+	if q.log != nil {
+		if err := q.log.appendEnqueue(m); err != nil {
+			q.mu.Unlock()
+			return 0, err
+		}
+	}
+	if m.Key != "" {
+		q.keys[m.Key] = m.ID
+	}
+	q.mu.Unlock()
+
+	if err := q.sched.push(ctx, m); err != nil {
+		// The message never became visible; take it back.
+		q.mu.Lock()
+		if m.Key != "" {
+			delete(q.keys, m.Key)
+		}
+		if q.log != nil {
+			q.log.appendAck(m.ID, nil)
+		}
+		q.mu.Unlock()
+		return 0, err
+	}
+	return m.ID, nil
+}
+
+func (q *messageQueue) Dequeue(ctx context.Context) (Message, error) {
+	// Count the call so a Close in between cannot release the log under a
+	// message that is about to be in flight.
+	q.mu.Lock()
+	q.dequeuing++
+	q.mu.Unlock()
+
+	m, err := q.sched.pop(ctx)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.dequeuing--
+	if err != nil {
+		q.releaseIfDone()
+		return Message{}, err
+	}
+	m.Deliveries++
+	f := &inflight{msg: m}
+	if q.cfg.visibility > 0 {
+		f.deadline = time.Now().Add(q.cfg.visibility)
+	}
+	q.inflight[m.ID] = f
+	m.RedeliverAt = f.deadline
+	return m, nil
+}
+
+func (q *messageQueue) Extend(id uint64) (time.Time, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	f, ok := q.inflight[id]
+	if !ok {
+		return time.Time{}, ErrUnknownMessage
+	}
+	if q.cfg.visibility > 0 {
+		f.deadline = time.Now().Add(q.cfg.visibility)
+	}
+	return f.deadline, nil
+}
+
+func (q *messageQueue) Ack(id uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	f, ok := q.inflight[id]
+	if !ok {
+		return ErrUnknownMessage
+	}
+	delete(q.inflight, id)
+	var key *ackedKey
+	if f.msg.Key != "" {
+		q.acked = append(q.acked, ackedKey{Key: f.msg.Key, ID: id, At: time.Now()})
+		key = &q.acked[len(q.acked)-1]
+	}
+	if q.log != nil {
+		if err := q.log.appendAck(id, key); err != nil {
+			return err
+		}
+	}
+	q.releaseIfDone()
+	return nil
+}
+
+func (q *messageQueue) Nack(id uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	f, ok := q.inflight[id]
+	if !ok {
+		return ErrUnknownMessage
+	}
+	delete(q.inflight, id)
+	q.redeliverLocked(f.msg)
+	return nil
+}
+
+// redeliverLocked makes a message that was in flight available again, or,
+// once the queue is closed, parks it: it stays unacknowledged in the log of
+// a durable queue and is dropped from an in-memory one.
+func (q *messageQueue) redeliverLocked(m Message) {
+	if q.closed {
+		if m.Key != "" {
+			delete(q.keys, m.Key)
+		}
+		q.releaseIfDone()
+		return
+	}
+	q.sched.requeue(m)
+}
+
+func (q *messageQueue) Depths() []QueueDepth {
+	return q.sched.depths()
+}
+
+func (q *messageQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	q.sched.close()
+	q.releaseIfDone()
+	return nil
+}
+
+// releaseIfDone stops the reaper and closes the log once the queue is
+// closed and has nothing left to deliver or acknowledge. Messages still
+// waiting when that happens stay in the log for the next start.
+func (q *messageQueue) releaseIfDone() {
+	if !q.closed || len(q.inflight) > 0 || q.dequeuing > 0 {
+		return
+	}
+	select {
+	case <-q.stop:
+		return
+	default:
+	}
+	if q.sched.len() > 0 {
+		return
+	}
+	close(q.stop)
+	if q.log != nil {
+		q.log.close()
+	}
+}
+
+// expireKeys forgets the idempotency keys that were acknowledged longer
+// than the retention period ago.
+func (q *messageQueue) expireKeys(now time.Time) {
+	n := 0
+	for ; n < len(q.acked) && now.Sub(q.acked[n].At) > q.cfg.keyRetention; n++ {
+		if q.keys[q.acked[n].Key] == q.acked[n].ID {
+			delete(q.keys, q.acked[n].Key)
+		}
+	}
+	q.acked = q.acked[n:]
+}
+
+// reap delivers again the messages whose visibility timeout has expired.
+func (q *messageQueue) reap() {
+	ticker := time.NewTicker(max(q.cfg.visibility/4, 10*time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.stop:
+			return
+		case now := <-ticker.C:
+			q.mu.Lock()
+			for id, f := range q.inflight {
+				if now.After(f.deadline) {
+					delete(q.inflight, id)
+					q.redeliverLocked(f.msg)
+				}
+			}
+			q.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestVisibilityTimeoutShorterThanJob checks that a job running longer
+// than the visibility timeout is not handed to another worker meanwhile.
+func TestVisibilityTimeoutShorterThanJob(t *testing.T) {
+	var calls atomic.Int32
+	p := New(func(ctx context.Context, n int) (int, error) {
+		calls.Add(1)
+		time.Sleep(60 * time.Millisecond)
+		return n, nil
+	}, WithWorkers(2), WithQueue(NewMemoryQueue(VisibilityTimeout(20*time.Millisecond))))
+	results := collect(p)
+
+	if _, err := p.Submit(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(150 * time.Millisecond)
+	shutdown(t, p)
+
+	if got := len(<-results); got != 1 {
+		t.Errorf("%d Results, want 1", got)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("the handler ran %d times, want 1", n)
+	}
+	if n := p.Metrics().Succeeded; n != 1 {
+		t.Errorf("Metrics().Succeeded = %d, want 1", n)
+	}
+}
+
+// unextendable is a queue whose visibility timeouts cannot be extended, as
+// if the worker holding a message had been paused for too long.
+type unextendable struct{ Queue }
+
+func (unextendable) Extend(uint64) (time.Time, error) {
+	return time.Time{}, ErrUnknownMessage
+}
+
+// TestRedeliveredJobHasOneResult checks that a job that does get delivered
+// again while it runs still produces one Result.
+func TestRedeliveredJobHasOneResult(t *testing.T) {
+	var calls atomic.Int32
+	q := unextendable{NewMemoryQueue(VisibilityTimeout(20 * time.Millisecond))}
+	p := New(func(ctx context.Context, n int) (int, error) {
+		calls.Add(1)
+		time.Sleep(60 * time.Millisecond)
+		return n, nil
+	}, WithWorkers(2), WithQueue(q))
+	results := collect(p)
+
+	f, err := p.Submit(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	shutdown(t, p)
+
+	if n := calls.Load(); n < 2 {
+		t.Fatalf("the handler ran %d times; the test needs the job delivered again", n)
+	}
+	if got := len(<-results); got != 1 {
+		t.Errorf("%d Results for a job delivered %d times, want 1", got, calls.Load())
+	}
+	if n := p.Metrics().Succeeded; n != 1 {
+		t.Errorf("Metrics().Succeeded = %d, want 1", n)
+	}
+}
+
+// failing is a queue whose Dequeue fails until the pool closes it.
+type failing struct {
+	Queue
+	calls  atomic.Int32
+	closed atomic.Bool
+}
+
+func (q *failing) Dequeue(ctx context.Context) (Message, error) {
+	q.calls.Add(1)
+	if q.closed.Load() {
+		return Message{}, ErrQueueClosed
+	}
+	return Message{}, errors.New("disk on fire")
+}
+
+func (q *failing) Close() error {
+	q.closed.Store(true)
+	return q.Queue.Close()
+}
+
+// TestDequeueErrorBacksOff checks that a worker whose queue keeps failing
+// waits between attempts and reports every failure.
+func TestDequeueErrorBacksOff(t *testing.T) {
+	q := &failing{Queue: NewMemoryQueue()}
+	var mu sync.Mutex
+	var backoffs []time.Duration
+	p := New(func(ctx context.Context, n int) (int, error) { return n, nil },
+		WithWorkers(1), WithQueue(q), WithoutResults(),
+		WithHook(func(e Event) {
+			if e.Kind == EventQueueError {
+				mu.Lock()
+				backoffs = append(backoffs, e.Backoff)
+				mu.Unlock()
+			}
+		}))
+	time.Sleep(100 * time.Millisecond)
+	shutdown(t, p)
+
+	// 10ms, 20ms and 40ms fit in 100ms; a spinning worker calls Dequeue
+	// thousands of times.
+	if n := q.calls.Load(); n > 10 {
+		t.Errorf("Dequeue called %d times in 100ms", n)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(backoffs) < 2 || backoffs[1] != 2*backoffs[0] {
+		t.Errorf("backoffs %v, want them to double", backoffs)
+	}
+}
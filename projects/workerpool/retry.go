@@ -0,0 +1,121 @@
+package workerpool
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy decides whether and when a failed job runs again. A job is
+// retried while its error is retryable and it has made fewer than
+// MaxAttempts attempts. Before attempt n+1 the worker waits
+//
+//	min(InitialBackoff * Multiplier^(n-1), MaxBackoff)
+//
+// shortened by a random fraction of up to Jitter, so that jobs which failed
+// together do not all retry at the same moment.
+//
+// The worker waits out the backoff itself, so a job that is backing off
+// occupies a worker.
+type RetryPolicy struct {
+	MaxAttempts    int           // including the first; 0 or 1 means no retries
+	InitialBackoff time.Duration // default 100ms
+	MaxBackoff     time.Duration // default 10s
+	Multiplier     float64       // default 2
+	Jitter         float64       // 0 to 1, default 0
+
+	// Retryable reports whether a job that failed with err may be retried.
+	// By default every error is retryable except those wrapped with
+	// Permanent and handler panics. Errors wrapped with Permanent are never
+	// retried, whatever Retryable says.
+	Retryable func(err error) bool
+}
+
+// Attempt records one run of a job.
+type Attempt struct {
+	Number   int
+	Start    time.Time
+	Duration time.Duration
+	Err      error
+}
+
+// DeadLetter is a job that failed for good: it ran out of attempts or
+// failed with an error that is not retryable. Input can be submitted again
+// once the cause is fixed.
+type DeadLetter[In any] struct {
+	JobID    uint64
+	Input    In
+	Attempts []Attempt
+	Err      error // the error of the last attempt
+}
+
+var errPermanent = errors.New("permanent")
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() []error {
+	return []error{e.err, errPermanent}
+}
+
+// Permanent marks err as not worth retrying.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+func (r RetryPolicy) withDefaults() RetryPolicy {
+	if r.MaxAttempts < 1 {
+		r.MaxAttempts = 1
+	}
+	if r.InitialBackoff <= 0 {
+		r.InitialBackoff = 100 * time.Millisecond
+	}
+	if r.MaxBackoff <= 0 {
+		r.MaxBackoff = 10 * time.Second
+	}
+	if r.Multiplier < 1 {
+		r.Multiplier = 2
+	}
+	r.Jitter = math.Min(math.Max(r.Jitter, 0), 1)
+	return r
+}
+
+func (r RetryPolicy) retryable(err error) bool {
+	if errors.Is(err, errPermanent) || errors.Is(err, ErrStopped) {
+		return false
+	}
+	if r.Retryable != nil {
+		return r.Retryable(err)
+	}
+	return !errors.Is(err, ErrPanic)
+}
+
+// backoff returns how long to wait after the given failed attempt.
+func (r RetryPolicy) backoff(attempt int) time.Duration {
+	d := float64(r.InitialBackoff) * math.Pow(r.Multiplier, float64(attempt-1))
+	d = math.Min(d, float64(r.MaxBackoff))
+	d -= d * r.Jitter * rand.Float64()
+	return time.Duration(d)
+}
+
+// OnDeadLetter calls sink with every job that failed for good, after its
+// Result has been produced, so failures can be inspected or submitted
+// again. Jobs cancelled by a forced stop are not dead letters. The sink runs
+// on the worker and should return quickly. A later call replaces the sink;
+// nil removes it.
+//
+// Workers start in New, so a job that fails before OnDeadLetter is called
+// (one replayed from a durable queue, say) is not reported to the sink.
+func (p *Pool[In, Out]) OnDeadLetter(sink func(DeadLetter[In])) {
+	if sink == nil {
+		p.deadLetter.Store(nil)
+		return
+	}
+	p.deadLetter.Store(&sink)
+}
@@ -0,0 +1,252 @@
+package workerpool
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Priority orders jobs: a worker always takes a job of the highest priority
+// that has one waiting. Within a priority, tenants take turns.
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+	PriorityUrgent
+
+	numPriorities = int(PriorityUrgent) + 1
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	case PriorityUrgent:
+		return "urgent"
+	default:
+		return "unknown"
+	}
+}
+
+// QueueDepth is the number of jobs one tenant has waiting at one priority.
+type QueueDepth struct {
+	Priority Priority
+	Tenant   string
+	Depth    int
+}
+
+// scheduler orders the waiting messages of the built-in queues. Priorities are strict, so
+// a steady stream of urgent jobs can starve low ones; that is the point of
+// having them. Within a priority, tenants are served by deficit round-robin:
+// on each turn a tenant earns its weight in credit and may take one job per
+// credit, so a tenant of weight 3 gets three jobs through for every one of a
+// tenant of weight 1, and a tenant flooding the queue only delays itself.
+type scheduler struct {
+	mu       sync.Mutex
+	levels   [numPriorities]level
+	size     int
+	capacity int
+	weights  map[string]int
+	closed   bool
+
+	// ready is closed and replaced whenever a message is pushed or the
+	// scheduler is closed; space whenever one is popped. Waiters select
+	// on them, which, unlike sync.Cond, lets Submit give up when its
+	// context is done.
+	ready chan struct{}
+	space chan struct{}
+}
+
+// level is one priority's tenants; active holds those with jobs waiting,
+// in round-robin order starting at next.
+type level struct {
+	tenants map[string]*tenantQueue
+	active  []*tenantQueue
+	next    int
+}
+
+type tenantQueue struct {
+	name     string
+	messages []Message
+	deficit  int
+}
+
+func newScheduler(capacity int, weights map[string]int) *scheduler {
+	s := &scheduler{
+		capacity: max(capacity, 1),
+		weights:  weights,
+		ready:    make(chan struct{}),
+		space:    make(chan struct{}),
+	}
+	for i := range s.levels {
+		s.levels[i].tenants = make(map[string]*tenantQueue)
+	}
+	return s
+}
+
+// push queues m, waiting while the scheduler is full. It fails with
+// ErrQueueClosed once the scheduler is closed, and with ctx's error if ctx
+// is done first.
+func (s *scheduler) push(ctx context.Context, m Message) error {
+	s.mu.Lock()
+	for !s.closed && s.size >= s.capacity {
+		space := s.space
+		s.mu.Unlock()
+		select {
+		case <-space:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		s.mu.Lock()
+	}
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrQueueClosed
+	}
+	s.add(m)
+	return nil
+}
+
+// requeue queues m regardless of the capacity, for messages that were
+// already accepted once.
+func (s *scheduler) requeue(m Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.add(m)
+}
+
+func (s *scheduler) add(m Message) {
+	l := &s.levels[clampPriority(m.Priority)]
+	tq, ok := l.tenants[m.Tenant]
+	if !ok {
+		tq = &tenantQueue{name: m.Tenant}
+		l.tenants[m.Tenant] = tq
+	}
+	if len(tq.messages) == 0 {
+		l.active = append(l.active, tq)
+	}
+	tq.messages = append(tq.messages, m)
+	s.size++
+	if !s.closed {
+		close(s.ready)
+		s.ready = make(chan struct{})
+	}
+}
+
+// pop returns the next message, waiting while the scheduler is empty. It
+// fails with ErrQueueClosed once the scheduler is closed and empty, and
+// with ctx's error if ctx is done first.
+func (s *scheduler) pop(ctx context.Context) (Message, error) {
+	s.mu.Lock()
+	for s.size == 0 {
+		if s.closed {
+			s.mu.Unlock()
+			return Message{}, ErrQueueClosed
+		}
+		ready := s.ready
+		s.mu.Unlock()
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return Message{}, ctx.Err()
+		}
+		s.mu.Lock()
+	}
+	defer s.mu.Unlock()
+
+	for i := numPriorities - 1; i >= 0; i-- {
+		l := &s.levels[i]
+		if len(l.active) == 0 {
+			continue
+		}
+		m := s.take(l)
+		s.size--
+		if !s.closed {
+			close(s.space)
+			s.space = make(chan struct{})
+		}
+		return m, nil
+	}
+	panic("workerpool: scheduler size out of sync")
+}
+
+// take removes the next message of l in deficit round-robin order.
+func (s *scheduler) take(l *level) Message {
+	if l.next >= len(l.active) {
+		l.next = 0
+	}
+	tq := l.active[l.next]
+	if tq.deficit < 1 {
+		tq.deficit += s.weight(tq.name)
+	}
+	m := tq.messages[0]
+	tq.messages[0] = Message{}
+	tq.messages = tq.messages[1:]
+	tq.deficit--
+
+	switch {
+	case len(tq.messages) == 0:
+		// An idle tenant does not save up credit.
+		tq.deficit = 0
+		l.active = append(l.active[:l.next], l.active[l.next+1:]...)
+		delete(l.tenants, tq.name)
+	case tq.deficit < 1:
+		l.next++
+	}
+	return m
+}
+
+func (s *scheduler) weight(tenant string) int {
+	if w, ok := s.weights[tenant]; ok && w > 0 {
+		return w
+	}
+	return 1
+}
+
+// len returns the number of waiting messages.
+func (s *scheduler) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// close stops accepting messages and wakes every waiter. Messages already
+// queued can still be popped.
+func (s *scheduler) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.ready)
+	close(s.space)
+}
+
+func (s *scheduler) depths() []QueueDepth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var depths []QueueDepth
+	for i := numPriorities - 1; i >= 0; i-- {
+		for _, tq := range s.levels[i].active {
+			depths = append(depths, QueueDepth{Priority: Priority(i), Tenant: tq.name, Depth: len(tq.messages)})
+		}
+	}
+	sort.SliceStable(depths, func(a, b int) bool {
+		if depths[a].Priority != depths[b].Priority {
+			return depths[a].Priority > depths[b].Priority
+		}
+		return depths[a].Tenant < depths[b].Tenant
+	})
+	return depths
+}
+
+func clampPriority(p Priority) Priority {
+	return min(max(p, PriorityLow), PriorityUrgent)
+}
@@ -0,0 +1,48 @@
+package workerpool
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPrioritiesAndTenantWeights(t *testing.T) {
+	q := NewMemoryQueue(TenantWeight("acme", 2))
+	defer q.Close()
+	ctx := context.Background()
+	enqueue := func(tenant string, priority Priority) {
+		t.Helper()
+		if _, err := q.Enqueue(ctx, Message{Payload: tenant, Tenant: tenant, Priority: priority}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	enqueue("", PriorityLow)
+	for i := 0; i < 4; i++ {
+		enqueue("bulk", PriorityNormal)
+	}
+	for i := 0; i < 4; i++ {
+		enqueue("acme", PriorityNormal)
+	}
+	enqueue("", PriorityUrgent)
+
+	if got, want := fmt.Sprint(q.Depths()), "[{urgent  1} {normal acme 4} {normal bulk 4} {low  1}]"; got != want {
+		t.Errorf("Depths = %v, want %v", got, want)
+	}
+
+	// Urgent first, low last; in between acme, with twice bulk's weight,
+	// takes two jobs per turn until it runs out.
+	var order []string
+	for i := 0; i < 10; i++ {
+		m, err := q.Dequeue(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q.Ack(m.ID)
+		order = append(order, fmt.Sprintf("%s/%s", m.Priority, m.Tenant))
+	}
+	want := "urgent/ normal/bulk normal/acme normal/acme normal/bulk normal/acme normal/acme normal/bulk normal/bulk low/"
+	if got := strings.Join(order, " "); got != want {
+		t.Errorf("dequeued\n\t%s\nwant\n\t%s", got, want)
+	}
+}